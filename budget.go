@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const defaultBudget = 32000
+
+// Settings of a selection file that control the token budget.
+const budgetSetting = "budget"
+const budgetModeSetting = "budget-mode"
+
+// budgetPresets maps model names to the size of their context window.
+var budgetPresets = map[string]int{
+	"gpt-4":     8192,
+	"gpt-4-32k": 32768,
+	"gpt-4o":    128000,
+	"claude":    200000,
+	"gemini":    1000000,
+	"llama3":    8192,
+	"mistral":   32000,
+}
+
+// Budget is the token limit of the copied context. A zero Limit means there
+// is no limit. With Hard set copying is refused when the limit is exceeded,
+// otherwise only a warning is shown.
+type Budget struct {
+	Limit int
+	Hard  bool
+}
+
+// parseBudget accepts a plain number, a number with a k or m suffix (128k),
+// a model preset or "none".
+func parseBudget(raw string) (int, error) {
+	s := strings.ToLower(strings.TrimSpace(raw))
+	if limit, ok := budgetPresets[s]; ok {
+		return limit, nil
+	}
+	switch s {
+	case "none", "off", "0":
+		return 0, nil
+	}
+
+	multiplier := 1
+	if strings.HasSuffix(s, "k") {
+		multiplier = 1000
+		s = strings.TrimSuffix(s, "k")
+	} else if strings.HasSuffix(s, "m") {
+		multiplier = 1000000
+		s = strings.TrimSuffix(s, "m")
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid token budget '%s'", raw)
+	}
+	return int(n * float64(multiplier)), nil
+}
+
+func parseBudgetMode(s string) (bool, error) {
+	switch s {
+	case "hard":
+		return true, nil
+	case "warn", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid budget mode '%s' (use warn or hard)", s)
+}
+
+// resolveBudget combines the budget of the config files with the settings of
+// the selection file, which are more specific. Environment variables and
+// command line flags still override both.
+func resolveBudget(cfg *Config, settings map[string]string) (Budget, error) {
+	limitStr := cfg.Get("budget.limit")
+	if value, ok := settings[budgetSetting]; ok && !cfg.IsOverridden("budget.limit") {
+		limitStr = value
+	}
+	modeStr := cfg.Get("budget.mode")
+	if value, ok := settings[budgetModeSetting]; ok && !cfg.IsOverridden("budget.mode") {
+		modeStr = value
+	}
+
+	limit, err := parseBudget(limitStr)
+	if err != nil {
+		return Budget{Limit: defaultBudget}, err
+	}
+	hard, err := parseBudgetMode(modeStr)
+	if err != nil {
+		return Budget{Limit: limit}, err
+	}
+	return Budget{Limit: limit, Hard: hard}, nil
+}
+
+func (b Budget) Exceeded(tokens int) bool {
+	return b.Limit > 0 && tokens > b.Limit
+}
+
+func (b Budget) String() string {
+	if b.Limit == 0 {
+		return "no limit"
+	}
+	mode := "warn"
+	if b.Hard {
+		mode = "hard"
+	}
+	return fmt.Sprintf("%s tokens (%s)", formatTokenCount(b.Limit), mode)
+}
+
+// formatTokenCount shortens large counts, 128000 becomes 128k.
+func formatTokenCount(n int) string {
+	switch {
+	case n >= 1000000 && n%1000000 == 0:
+		return fmt.Sprintf("%dm", n/1000000)
+	case n >= 10000:
+		return fmt.Sprintf("%.0fk", float64(n)/1000)
+	case n >= 1000:
+		return fmt.Sprintf("%.1fk", float64(n)/1000)
+	}
+	return strconv.Itoa(n)
+}
+
+// renderBudgetBar draws a bar of width cells filled by the share of the
+// budget used.
+func renderBudgetBar(used int, limit int, width int) string {
+	if limit <= 0 || width <= 0 {
+		return ""
+	}
+	filled := min(used*width/limit, width)
+	return strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
-
-	"github.com/atotto/clipboard"
 )
 
 func HandleRun(params []string, flags map[string]string) {
@@ -36,33 +37,226 @@ func HandleOpen(params []string, flags map[string]string) {
 }
 
 func HandleAdd(params []string, flags map[string]string) {
-	VarifyFlags(flags, []string{"help", "dir"})
+	VarifyFlags(flags, []string{"help", "dir", "glob", "regex", "exclude", "priority", "outline", "symbols", "deps", "depth", "reverse"})
 
 	if HasFlag(flags, "help") {
 		fmt.Printf("Help for add....")
 		return
 	}
+	if HasFlag(flags, "deps") {
+		HandleAddDeps(params, flags)
+		return
+	}
 
 	dir := GetFlag(flags, "dir", ".")
+	priority := 0
+	if HasFlag(flags, "priority") {
+		p, err := strconv.Atoi(flags["priority"])
+		if err != nil {
+			fmt.Printf("Error: invalid priority '%s'\n", flags["priority"])
+			os.Exit(1)
+		}
+		priority = p
+	}
+
+	outline := HasFlag(flags, "outline")
+	var symbols []string
+	if value := GetFlag(flags, "symbols", ""); value != "" {
+		symbols = strings.Split(value, ",")
+	}
 
-	config := readConfig(dir)
+	matcher, err := matcherFromFlags(flags)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if matcher == nil && len(params) == 0 {
+		fmt.Println("Error: give files to add, or a pattern with --glob or --regex")
+		os.Exit(1)
+	}
+	if len(symbols) > 0 && (matcher != nil || outline) {
+		fmt.Println("Error: --symbols only works with files given by name and without --outline")
+		os.Exit(1)
+	}
+
+	selection := readSelection(dir)
+	if matcher != nil {
+		root, _ := buildFileTree(dir)
+		files := matcher.Files(root, dir)
+		if len(files) == 0 {
+			fmt.Println("No files match")
+		}
+		for _, node := range files {
+			rel, _ := filepath.Rel(dir, node.Path)
+			if addWholeFile(selection, rel, priority, outline) {
+				fmt.Printf("Added: %s\n", rel)
+			}
+		}
+	}
+
+	ignore := NewIgnoreMatcher(dir)
 	for _, f := range params {
-		clean := filepath.Clean(f)
+		sel, err := parseSelectionEntry(f)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		clean := filepath.Clean(sel.Path)
+		sel.Path = clean
 
 		path := filepath.Join(dir, clean)
-		if !FileExists(path) {
+		info, err := os.Stat(path)
+		if err != nil {
 			fmt.Printf("Error: File '%s' doesn't exist in directory '%s'", f, dir)
 			os.Exit(1)
 		}
+		if ignore.Match(clean, info.IsDir()) {
+			fmt.Printf("Skipped: %s is ignored\n", clean)
+			continue
+		}
+		if sel.IsPartial() {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			lines := len(fileLines(content))
+			for _, r := range sel.Ranges {
+				if r.Start > lines {
+					fmt.Printf("Error: line range %s is past the end of '%s' (%d lines)\n", r, clean, lines)
+					os.Exit(1)
+				}
+			}
+		}
+
+		if (outline || len(symbols) > 0) && sel.IsPartial() {
+			fmt.Printf("Error: --outline and --symbols can't be combined with line ranges in '%s'\n", f)
+			os.Exit(1)
+		}
+		if len(symbols) > 0 {
+			missing, err := missingSymbols(path, symbols)
+			if err != nil {
+				fmt.Printf("Error: can't read the symbols of '%s': %v\n", f, err)
+				os.Exit(1)
+			}
+			if len(missing) > 0 {
+				fmt.Printf("Error: '%s' doesn't declare %s\n", f, strings.Join(missing, ", "))
+				os.Exit(1)
+			}
+		}
+
+		// Adding ranges to a partially selected file extends it, anything else
+		// replaces the previous entry. Ranges narrowing down a file that was
+		// selected in full are pointed out.
+		if existing, ok := selection[clean]; ok && sel.IsPartial() {
+			if existing.IsPartial() {
+				sel.Ranges = normalizeRanges(append(existing.Ranges, sel.Ranges...))
+			} else if !existing.Outline && len(existing.Symbols) == 0 {
+				fmt.Printf("Warning: %s was selected in full, narrowed to lines %s\n", clean, formatRanges(sel.Ranges))
+			}
+		}
+		sel.Priority = priority
+		sel.Outline = outline && !info.IsDir() && outlineAllowed(clean)
+		sel.Symbols = symbols
+		putSelection(selection, sel)
+		fmt.Printf("Added: %s\n", sel)
+	}
+	writeSelection(dir, selection)
+}
 
-		config[clean] = true
-		fmt.Printf("Added: %s\n", clean)
+// outlineAllowed reports whether the file rel can be added as an outline,
+// and warns that it is added in full otherwise.
+func outlineAllowed(rel string) bool {
+	if err := outlineError(rel); err != nil {
+		fmt.Printf("Warning: %v, %s is added in full\n", err, rel)
+		return false
 	}
-	writeConfig(dir, config)
+	return true
+}
+
+// addWholeFile adds the file rel to selection and reports whether it was
+// new. A file that is already selected keeps its line ranges, unless it is
+// turned into an outline, and takes the priority if one is given.
+func addWholeFile(selection map[string]Selection, rel string, priority int, outline bool) bool {
+	outline = outline && outlineAllowed(rel)
+	existing, ok := selection[rel]
+	if !ok {
+		putSelection(selection, Selection{Path: rel, Priority: priority, Outline: outline})
+		return true
+	}
+	if priority != 0 {
+		existing.Priority = priority
+	}
+	if outline {
+		existing.Outline = true
+		existing.Ranges = nil
+	}
+	selection[rel] = existing
+	return false
+}
+
+// HandleAddDeps adds Go files with the files of the module packages they
+// import, or with --reverse the files that import their packages.
+func HandleAddDeps(params []string, flags map[string]string) {
+	dir := GetFlag(flags, "dir", ".")
+	cfg := loadConfig(dir, flags)
+	if len(params) == 0 {
+		fmt.Println("Usage: punjado add --deps <file.go>... [--depth N] [--reverse]")
+		os.Exit(1)
+	}
+	depth, err := strconv.Atoi(cfg.Get("deps.depth"))
+	if err != nil || depth < 0 {
+		fmt.Printf("Error: invalid depth '%s'\n", cfg.Get("deps.depth"))
+		os.Exit(1)
+	}
+	priority := 0
+	if HasFlag(flags, "priority") {
+		if priority, err = strconv.Atoi(flags["priority"]); err != nil {
+			fmt.Printf("Error: invalid priority '%s'\n", flags["priority"])
+			os.Exit(1)
+		}
+	}
+
+	var files []string
+	for _, f := range params {
+		path := filepath.Join(dir, filepath.Clean(f))
+		if !strings.HasSuffix(f, ".go") || !FileExists(path) {
+			fmt.Printf("Error: '%s' is not a Go file in directory '%s'\n", f, dir)
+			os.Exit(1)
+		}
+		files = append(files, path)
+	}
+	deps, err := goDeps(files, depth, HasFlag(flags, "reverse"))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	selection := readSelection(dir)
+	ignore := NewIgnoreMatcher(dir)
+	for _, path := range append(files, deps...) {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(abs, path)
+		}
+		rel, err := filepath.Rel(abs, path)
+		// Packages outside of dir can't be selected from it.
+		if err != nil || strings.HasPrefix(rel, "..") || ignore.Match(rel, false) {
+			continue
+		}
+		if addWholeFile(selection, rel, priority, HasFlag(flags, "outline")) {
+			fmt.Printf("Added: %s\n", rel)
+		}
+	}
+	writeSelection(dir, selection)
 }
 
 func HandleRemove(params []string, flags map[string]string) {
-	VarifyFlags(flags, []string{"help", "dir"})
+	VarifyFlags(flags, []string{"help", "dir", "glob", "regex", "exclude"})
 
 	if HasFlag(flags, "help") {
 		fmt.Printf("Help for remove....")
@@ -71,17 +265,39 @@ func HandleRemove(params []string, flags map[string]string) {
 
 	dir := GetFlag(flags, "dir", ".")
 
-	config := readConfig(dir)
+	matcher, err := matcherFromFlags(flags)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	selection := readSelection(dir)
+	if matcher != nil {
+		// Patterns are matched against the selection rather than the tree, so
+		// files deleted since they were added can be removed too.
+		var paths []string
+		for path := range selection {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			if matcher.Match(path) {
+				delete(selection, path)
+				fmt.Printf("Removed: %s\n", path)
+			}
+		}
+	}
 	for _, f := range params {
-		clean := filepath.Clean(f)
-		delete(config, clean)
+		sel, _ := parseSelectionEntry(f)
+		clean := filepath.Clean(sel.Path)
+		delete(selection, clean)
 		fmt.Printf("Removed: %s\n", clean)
 	}
-	writeConfig(dir, config)
+	writeSelection(dir, selection)
 }
 
 func HandleCopy(params []string, flags map[string]string) {
-	VarifyFlags(flags, []string{"help", "dir", "stdout"})
+	VarifyFlags(flags, []string{"help", "dir", "stdout", "budget", "clipboard", "format", "template", "sort", "tree", "tree-depth"})
 
 	if HasFlag(flags, "help") {
 		fmt.Printf("Help for copy....")
@@ -89,31 +305,53 @@ func HandleCopy(params []string, flags map[string]string) {
 	}
 
 	dir := GetFlag(flags, "dir", ".")
+	cfg := loadConfig(dir, flags)
 
-	useStdOut := HasFlag(flags, "stdout")
+	selection := readSelection(dir)
+	selected, err := sortSelection(dir, selection, GetFlag(flags, "sort", cfg.Get("output.sort")))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	tree, err := projectTree(dir, selection, cfg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	finalText, files, err := buildContext(dir, selected, tree, cfg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	deliverContext(dir, cfg, finalText, files, HasFlag(flags, "stdout"))
+}
 
-	config := readConfig(dir)
-	var sb strings.Builder
-	for path := range config {
-		sb.WriteString(fmt.Sprintf("\n--- FILE: %s ---\n", path))
-		content, err := os.ReadFile(filepath.Join(dir, path))
-		if err != nil {
-			sb.WriteString(fmt.Sprintf("(Error reading file: %v)\n", err))
-		} else {
-			sb.Write(content)
+// deliverContext checks text against the budget and puts it on the
+// clipboard, or prints it with stdout.
+func deliverContext(dir string, cfg *Config, finalText string, files int, useStdOut bool) {
+	budget, err := resolveBudget(cfg, readSettings(dir))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	tokens := defaultTokenizer().Count(finalText)
+	if budget.Exceeded(tokens) {
+		if budget.Hard {
+			fmt.Printf("Error: context is %d tokens, over the budget of %d tokens\n", tokens, budget.Limit)
+			os.Exit(1)
 		}
-		sb.WriteString("\n")
+		fmt.Fprintf(os.Stderr, "Warning: context is %d tokens, over the budget of %d tokens\n", tokens, budget.Limit)
 	}
-	finalText := sb.String()
+
 	if useStdOut {
 		fmt.Print(finalText)
 	} else {
-		err := clipboard.WriteAll(finalText)
+		err := copyToClipboard(finalText, cfg.Get("clipboard.backend"))
 		if err != nil {
 			fmt.Println("Error copying to clipboard (install xclip/wl-copy on Linux):", err)
 			os.Exit(1)
 		}
-		fmt.Printf("Copied %d files to clipboard!\n", len(config))
+		fmt.Printf("Copied %d files (%d tokens) to clipboard!\n", files, tokens)
 	}
 }
 
@@ -125,9 +363,80 @@ func HandleProfile(params []string, flags map[string]string) {
 		return
 	}
 
-	// dir := GetFlag(flags, "dir", ".")
+	dir := GetFlag(flags, "dir", ".")
+
+	if len(params) < 1 {
+		fmt.Println("Usage: punjado profile save|load|list|delete|diff <name>")
+		return
+	}
+
+	needName := func(n int) {
+		if len(params) < n+1 {
+			fmt.Printf("Usage: punjado profile %s <name>\n", params[0])
+			os.Exit(1)
+		}
+	}
+
+	switch params[0] {
+	case "save":
+		needName(1)
+		name := params[1]
+		if err := writeProfile(dir, name, readSettings(dir), readSelection(dir)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Saved profile: %s\n", name)
+
+	case "load":
+		needName(1)
+		name := params[1]
+		selection, err := readProfile(dir, name)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		settings, _ := readProfileSettings(dir, name)
+		writeState(dir, settings, selection)
+		fmt.Printf("Loaded profile: %s (%d files)\n", name, len(selection))
+
+	case "list":
+		for _, name := range listProfiles(dir) {
+			fmt.Println(name)
+		}
 
-	fmt.Printf("Error: HandleProfile not implemented")
+	case "delete":
+		needName(1)
+		name := params[1]
+		if err := deleteProfile(dir, name); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted profile: %s\n", name)
+
+	case "diff":
+		// With a single profile the current selection is the other side.
+		needName(1)
+		a, err := readProfile(dir, params[1])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		b := readSelection(dir)
+		if len(params) > 2 {
+			b, err = readProfile(dir, params[2])
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		for _, line := range diffSelections(a, b) {
+			fmt.Println(line)
+		}
+
+	default:
+		fmt.Printf("Error: unknown profile command '%s'\n", params[0])
+		os.Exit(1)
+	}
 }
 
 func HandleToggle(params []string, flags map[string]string) {
@@ -144,56 +453,233 @@ func HandleToggle(params []string, flags map[string]string) {
 		fmt.Println("Usage: punjado toggle <file>")
 		return
 	}
-	config := readConfig(dir)
-	file := filepath.Clean(params[0])
+	selection := readSelection(dir)
+	sel, err := parseSelectionEntry(params[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	file := filepath.Clean(sel.Path)
+	sel.Path = file
 
-	if config[file] {
-		delete(config, file)
+	if _, ok := selection[file]; ok {
+		delete(selection, file)
 		fmt.Printf("Removed: %s\n", file)
 	} else {
-		config[file] = true
-		fmt.Printf("Added: %s\n", file)
+		putSelection(selection, sel)
+		fmt.Printf("Added: %s\n", sel)
 	}
-	writeConfig(dir, config)
+	writeSelection(dir, selection)
 }
 
 func HandleGit(params []string, flags map[string]string) {
-	VarifyFlags(flags, []string{"help", "dir"})
+	if len(params) > 0 {
+		switch params[0] {
+		case "diff":
+			HandleGitDiff(params[1:], flags)
+			return
+		case "commits":
+			HandleGitCommits(params[1:], flags)
+			return
+		case "branch":
+			HandleGitBranch(params[1:], flags)
+			return
+		}
+	}
+	if len(params) > 0 && params[0] != "status" {
+		fmt.Printf("Error: unknown git command '%s'\n", params[0])
+		os.Exit(1)
+	}
+	VarifyFlags(flags, []string{"help", "dir", "staged", "unstaged", "untracked"})
 
 	if HasFlag(flags, "help") {
-		fmt.Printf("Help for toggle....")
+		fmt.Println("Usage: punjado git [status] [--staged] [--unstaged] [--untracked]")
 		return
 	}
 
 	dir := GetFlag(flags, "dir", ".")
-
-	cmd := exec.Command("git", "status", "--porcelain")
-	output, err := cmd.Output()
+	entries, err := gitStatus(dir)
 	if err != nil {
-		fmt.Println("Error running git status. Is this a git repo?")
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
-	config := readConfig(dir)
-	lines := strings.Split(string(output), "\n")
-	count := 0
-	for _, line := range lines {
-		if len(line) < 4 {
+
+	// Without a filter every change counts, with some the changes any of
+	// them matches.
+	staged, unstaged, untracked := HasFlag(flags, "staged"), HasFlag(flags, "unstaged"), HasFlag(flags, "untracked")
+	all := !staged && !unstaged && !untracked
+	var changes []gitChange
+	for _, entry := range entries {
+		if !all && !(staged && entry.Staged() || unstaged && entry.Unstaged() || untracked && entry.Untracked()) {
 			continue
 		}
-		path := strings.TrimSpace(line[3:])
-		path = filepath.Clean(path)
-		if !config[path] {
-			config[path] = true
+		change := gitChange{Status: 'M', Path: entry.Path, From: entry.From}
+		if entry.From != "" {
+			change.Status = 'R'
+		}
+		changes = append(changes, change)
+	}
+
+	selection := readSelection(dir)
+	added, removed := selectGitChanges(dir, selection, changes)
+	writeSelection(dir, selection)
+	fmt.Printf("Successfully added %d and removed %d files from git status.\n", added, removed)
+}
+
+// selectGitChanges adds the changed files to selection, except the ignored
+// ones. The files that no longer exist and the old paths of renamed ones are
+// removed from it.
+func selectGitChanges(dir string, selection map[string]Selection, changes []gitChange) (added int, removed int) {
+	ignore := NewIgnoreMatcher(dir)
+	remove := func(path string) {
+		if _, ok := selection[path]; ok {
+			delete(selection, path)
+			fmt.Printf("Git file removed: %s\n", path)
+			removed++
+		}
+	}
+	for _, change := range changes {
+		path := filepath.FromSlash(change.Path)
+		if isStateFile(filepath.Base(path)) {
+			continue
+		}
+		if change.Status == 'R' && change.From != "" {
+			remove(filepath.FromSlash(change.From))
+		}
+		if change.Status == 'D' || !FileExists(filepath.Join(dir, path)) {
+			remove(path)
+			continue
+		}
+		if ignore.Match(path, false) {
+			fmt.Printf("Skipped: %s is ignored\n", path)
+			continue
+		}
+		if _, ok := selection[path]; !ok {
+			putSelection(selection, Selection{Path: path})
 			fmt.Printf("Git file added: %s\n", path)
-			count++
+			added++
 		}
 	}
-	writeConfig(dir, config)
-	fmt.Printf("Successfully added %d files from git status.\n", count)
+	return added, removed
+}
+
+// HandleGitDiff copies the changes of the working tree, the index or a
+// revision range as unified diffs, with --full followed by the files as
+// they are after the change.
+func HandleGitDiff(params []string, flags map[string]string) {
+	VarifyFlags(flags, []string{"help", "dir", "stdout", "budget", "clipboard", "format", "template", "tree", "tree-depth", "staged", "base", "full"})
+
+	if HasFlag(flags, "help") {
+		fmt.Println("Usage: punjado git diff [--staged] [<rev-range>] [--base <branch>] [--full]")
+		return
+	}
+	if len(params) > 1 {
+		fmt.Println("Usage: punjado git diff [--staged] [<rev-range>] [--base <branch>] [--full]")
+		os.Exit(1)
+	}
+
+	dir := GetFlag(flags, "dir", ".")
+	cfg := loadConfig(dir, flags)
+
+	diff := gitDiff{Staged: HasFlag(flags, "staged"), Base: GetFlag(flags, "base", "")}
+	if len(params) == 1 {
+		diff.Range = params[0]
+	}
+	files, changed, err := gitDiffFiles(dir, diff, HasFlag(flags, "full"))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(changed) == 0 {
+		fmt.Println("No changes.")
+		return
+	}
+
+	selection := make(map[string]Selection)
+	for _, path := range changed {
+		selection[path] = Selection{Path: path}
+	}
+	tree, err := projectTree(dir, selection, cfg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	text, _, err := formatContext(dir, files, "", tree, cfg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	deliverContext(dir, cfg, text, len(changed), HasFlag(flags, "stdout"))
+}
+
+// HandleGitCommits selects the files changed by a commit or a range of
+// commits.
+func HandleGitCommits(params []string, flags map[string]string) {
+	VarifyFlags(flags, []string{"help", "dir", "messages"})
+
+	if HasFlag(flags, "help") {
+		fmt.Println("Usage: punjado git commits <rev-range> [--messages]")
+		return
+	}
+	if len(params) != 1 {
+		fmt.Println("Usage: punjado git commits <rev-range> [--messages]")
+		os.Exit(1)
+	}
+
+	dir := GetFlag(flags, "dir", ".")
+	revs := commitRange(params[0])
+	selectCommitFiles(dir, revs, commitDiffRange(dir, revs), HasFlag(flags, "messages"))
+}
+
+// HandleGitBranch selects the files changed on the current branch since it
+// left the base branch.
+func HandleGitBranch(params []string, flags map[string]string) {
+	VarifyFlags(flags, []string{"help", "dir", "base", "messages"})
+
+	if HasFlag(flags, "help") {
+		fmt.Println("Usage: punjado git branch [--base <branch>] [--messages]")
+		return
+	}
+	if len(params) > 0 {
+		fmt.Println("Usage: punjado git branch [--base <branch>] [--messages]")
+		os.Exit(1)
+	}
+
+	dir := GetFlag(flags, "dir", ".")
+	base, err := branchBase(dir, GetFlag(flags, "base", ""))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	selectCommitFiles(dir, base+"..HEAD", base+"...HEAD", HasFlag(flags, "messages"))
+}
+
+// selectCommitFiles adds the files changed in diffRange to the selection.
+// Deleted files and the old paths of renamed ones are removed from it. With
+// messages the commit messages of logRange are put in front of the copied
+// context, otherwise the ones picked before are dropped.
+func selectCommitFiles(dir string, logRange string, diffRange string, messages bool) {
+	changes, err := gitChanges(dir, []string{"diff", "--relative", diffRange})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	selection := readSelection(dir)
+	added, removed := selectGitChanges(dir, selection, changes)
+
+	settings := readSettings(dir)
+	if messages {
+		settings[commitsSetting] = logRange
+	} else {
+		delete(settings, commitsSetting)
+	}
+	writeState(dir, settings, selection)
+	fmt.Printf("Successfully added %d and removed %d files changed in %s.\n", added, removed, logRange)
 }
 
 func HandleList(params []string, flags map[string]string) {
-	VarifyFlags(flags, []string{"help", "dir"})
+	VarifyFlags(flags, []string{"help", "dir", "sort"})
 
 	if HasFlag(flags, "help") {
 		fmt.Printf("Help for toggle....")
@@ -201,10 +687,29 @@ func HandleList(params []string, flags map[string]string) {
 	}
 
 	dir := GetFlag(flags, "dir", ".")
+	cfg := loadConfig(dir, nil)
 
-	config := readConfig(dir)
-	for file := range config {
-		fmt.Println(file)
+	selected, err := sortSelection(dir, readSelection(dir), GetFlag(flags, "sort", cfg.Get("output.sort")))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, sel := range selected {
+		var notes []string
+		if sel.Priority != 0 {
+			notes = append(notes, fmt.Sprintf("priority %d", sel.Priority))
+		}
+		if sel.Outline {
+			notes = append(notes, "outline")
+		}
+		if len(sel.Symbols) > 0 {
+			notes = append(notes, "symbols "+strings.Join(sel.Symbols, ", "))
+		}
+		if len(notes) > 0 {
+			fmt.Printf("%s (%s)\n", sel, strings.Join(notes, ", "))
+		} else {
+			fmt.Println(sel)
+		}
 	}
 }
 
@@ -223,9 +728,9 @@ func HandleStatus(params []string, flags map[string]string) {
 		return
 	}
 
-	config := readConfig(dir)
+	selection := readSelection(dir)
 	exists := false
-	for file := range config {
+	for file := range selection {
 		if file == params[0] {
 			exists = true
 			break
@@ -238,19 +743,379 @@ func HandleStatus(params []string, flags map[string]string) {
 	}
 }
 
+type fileTokens struct {
+	Path   string `json:"path"`
+	Tokens int    `json:"tokens"`
+}
+
 func HandleTokens(params []string, flags map[string]string) {
-	VarifyFlags(flags, []string{"help", "dir"})
+	VarifyFlags(flags, []string{"help", "dir", "sort", "json"})
 
 	if HasFlag(flags, "help") {
 		fmt.Printf("Help for tokens....")
 		return
 	}
 
-	// dir := GetFlag(flags, "dir", ".")
+	dir := GetFlag(flags, "dir", ".")
+	sortBy := GetFlag(flags, "sort", "tokens")
+
+	selection := readSelection(dir)
+	ignore := NewIgnoreMatcher(dir)
+	counter := NewTokenCounter()
+	defer counter.Save()
+
+	var files []fileTokens
+	total := 0
+	for path, sel := range selection {
+		if ignore.Match(path, false) {
+			continue
+		}
+		tokens, err := counter.CountSelected(filepath.Join(dir, path), sel.state())
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		label := sel.String()
+		if sel.Outline {
+			label += " (outline)"
+		}
+		if len(sel.Symbols) > 0 {
+			label += " (symbols " + strings.Join(sel.Symbols, ", ") + ")"
+		}
+		files = append(files, fileTokens{Path: label, Tokens: tokens})
+		total += tokens
+	}
+
+	switch sortBy {
+	case "tokens":
+		sort.Slice(files, func(i, j int) bool {
+			if files[i].Tokens != files[j].Tokens {
+				return files[i].Tokens > files[j].Tokens
+			}
+			return files[i].Path < files[j].Path
+		})
+	case "path", "name":
+		sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	default:
+		fmt.Printf("Error: unknown sort '%s' (use tokens or path)\n", sortBy)
+		os.Exit(1)
+	}
+
+	if HasFlag(flags, "json") {
+		out, _ := json.MarshalIndent(struct {
+			Total int          `json:"total"`
+			Files []fileTokens `json:"files"`
+		}{total, files}, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+
+	for _, f := range files {
+		fmt.Printf("%8d  %s\n", f.Tokens, f.Path)
+	}
+	fmt.Printf("%8d  total (%d files)\n", total, len(files))
+}
+
+func HandleIgnore(params []string, flags map[string]string) {
+	VarifyFlags(flags, []string{"help", "dir"})
+
+	if HasFlag(flags, "help") {
+		fmt.Printf("Help for ignore....")
+		return
+	}
+
+	dir := GetFlag(flags, "dir", ".")
+
+	if len(params) < 1 {
+		fmt.Println("Usage: punjado ignore add|remove|list <pattern>")
+		return
+	}
+
+	switch params[0] {
+	case "add":
+		for _, pattern := range params[1:] {
+			added, err := addIgnorePattern(dir, pattern)
+			if err != nil {
+				fmt.Println("Error writing ignore file:", err)
+				os.Exit(1)
+			}
+			if added {
+				fmt.Printf("Ignored: %s\n", pattern)
+			}
+		}
+	case "remove":
+		for _, pattern := range params[1:] {
+			removed, err := removeIgnorePattern(dir, pattern)
+			if err != nil {
+				fmt.Println("Error writing ignore file:", err)
+				os.Exit(1)
+			}
+			if removed {
+				fmt.Printf("Removed: %s\n", pattern)
+			} else {
+				fmt.Printf("Pattern '%s' not found\n", pattern)
+			}
+		}
+	case "list":
+		for _, pattern := range readIgnorePatterns(dir) {
+			fmt.Println(pattern)
+		}
+	default:
+		fmt.Printf("Error: unknown ignore command '%s'\n", params[0])
+		os.Exit(1)
+	}
+}
+
+func HandleHistory(params []string, flags map[string]string) {
+	VarifyFlags(flags, []string{"help", "dir"})
+
+	if HasFlag(flags, "help") {
+		fmt.Printf("Help for history....")
+		return
+	}
+
+	dir := GetFlag(flags, "dir", ".")
+
+	entries := readHistory(dir)
+
+	if len(params) > 0 && params[0] == "restore" {
+		if len(params) < 2 {
+			fmt.Println("Usage: punjado history restore <N>")
+			os.Exit(1)
+		}
+		n, err := strconv.Atoi(params[1])
+		if err != nil || n < 0 || n >= len(entries) {
+			fmt.Printf("Error: no history entry '%s'\n", params[1])
+			os.Exit(1)
+		}
+		// Entries are listed newest first, the journal is stored oldest first.
+		entry := entries[len(entries)-1-n]
+		writeSelection(dir, entry.selectionMap())
+		fmt.Printf("Restored selection from %s (%d files)\n", entry.Time.Format("2006-01-02 15:04:05"), len(entry.Selection))
+		return
+	}
+	if len(params) > 0 {
+		fmt.Printf("Error: unknown history command '%s'\n", params[0])
+		os.Exit(1)
+	}
+
+	for n := 0; n < len(entries); n++ {
+		i := len(entries) - 1 - n
+		entry := entries[i]
+		changes := ""
+		if i > 0 {
+			added, removed, changed := 0, 0, 0
+			for _, line := range diffSelections(entries[i-1].selectionMap(), entry.selectionMap()) {
+				switch line[0] {
+				case '+':
+					added++
+				case '-':
+					removed++
+				case '~':
+					changed++
+				}
+			}
+			changes = fmt.Sprintf("+%d -%d ~%d", added, removed, changed)
+		}
+		line := fmt.Sprintf("%3d  %s  %3d files  %s", n, entry.Time.Format("2006-01-02 15:04:05"), len(entry.Selection), changes)
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
 
+func HandleBudget(params []string, flags map[string]string) {
+	VarifyFlags(flags, []string{"help", "dir", "profile"})
 
-	// config := readConfig(dir)
-	fmt.Printf("Not implemented")
+	if HasFlag(flags, "help") {
+		fmt.Printf("Help for budget....")
+		return
+	}
+
+	dir := GetFlag(flags, "dir", ".")
+	profile := GetFlag(flags, "profile", "")
+
+	// The budget lives in the settings of the project selection or, with
+	// --profile, of a saved profile.
+	settings := readSettings(dir)
+	if profile != "" {
+		var err error
+		settings, err = readProfileSettings(dir, profile)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	save := func() {
+		if profile == "" {
+			writeSettings(dir, settings)
+			return
+		}
+		selection, _ := readProfile(dir, profile)
+		if err := writeProfile(dir, profile, settings, selection); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(params) == 0 {
+		printBudget(dir, settings)
+		return
+	}
+
+	switch params[0] {
+	case "set":
+		if len(params) < 2 {
+			fmt.Println("Usage: punjado budget set <tokens|preset>")
+			os.Exit(1)
+		}
+		if _, err := parseBudget(params[1]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		settings[budgetSetting] = params[1]
+	case "mode":
+		if len(params) < 2 {
+			fmt.Println("Usage: punjado budget mode warn|hard")
+			os.Exit(1)
+		}
+		if _, err := parseBudgetMode(params[1]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		settings[budgetModeSetting] = params[1]
+	case "clear":
+		delete(settings, budgetSetting)
+		delete(settings, budgetModeSetting)
+	case "presets":
+		names := make([]string, 0, len(budgetPresets))
+		for name := range budgetPresets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%-10s %s\n", name, formatTokenCount(budgetPresets[name]))
+		}
+		return
+	default:
+		fmt.Printf("Error: unknown budget command '%s'\n", params[0])
+		os.Exit(1)
+	}
+	save()
+	printBudget(dir, settings)
+}
+
+func printBudget(dir string, settings map[string]string) {
+	budget, err := resolveBudget(loadConfig(dir, nil), settings)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Budget: %s\n", budget)
+}
+
+func HandleConfig(params []string, flags map[string]string) {
+	VarifyFlags(flags, []string{"help", "dir", "global"})
+
+	if HasFlag(flags, "help") {
+		fmt.Printf("Help for config....")
+		return
+	}
+
+	dir := GetFlag(flags, "dir", ".")
+	path := projectConfigPath(dir)
+	if HasFlag(flags, "global") {
+		path = globalConfigPath()
+	}
+
+	if len(params) < 1 {
+		fmt.Println("Usage: punjado config get|set|list|edit [key] [value]")
+		return
+	}
+
+	switch params[0] {
+	case "get":
+		if len(params) < 2 {
+			fmt.Println("Usage: punjado config get <key>")
+			os.Exit(1)
+		}
+		v, ok := loadConfig(dir, flags).Lookup(params[1])
+		if !ok {
+			fmt.Printf("Error: unknown config key '%s'\n", params[1])
+			os.Exit(1)
+		}
+		fmt.Println(v)
+
+	case "set":
+		if len(params) < 3 {
+			fmt.Println("Usage: punjado config set <key> <value>")
+			os.Exit(1)
+		}
+		key, raw := params[1], strings.Join(params[2:], " ")
+		k, ok := findConfigKey(key)
+		if !ok {
+			fmt.Printf("Error: unknown config key '%s'\n", key)
+			os.Exit(1)
+		}
+		v := configValue{Value: raw}
+		if k.List {
+			// Lists are given as a TOML array or comma separated.
+			if strings.HasPrefix(raw, "[") {
+				parsed, err := parseConfigValue(raw)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				v = parsed
+			} else {
+				v = parseOverride(raw, true, "")
+			}
+		}
+		if err := validateConfigValue(key, v); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := setConfigFileValue(path, key, v); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s = %s\n", key, formatConfigValue(v))
+
+	case "list":
+		cfg := loadConfig(dir, flags)
+		for _, key := range cfg.Keys() {
+			v, _ := cfg.Lookup(key)
+			fmt.Printf("%s = %s (%s)\n", key, formatConfigValue(v), v.Source)
+		}
+
+	case "edit":
+		editor := os.Getenv("VISUAL")
+		if editor == "" {
+			editor = os.Getenv("EDITOR")
+		}
+		if editor == "" {
+			editor = "vi"
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		cmd := exec.Command(editor, path)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Printf("Error running editor: %v\n", err)
+			os.Exit(1)
+		}
+		_, problems, err := readConfigFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Warning: %v\n", err)
+		}
+		for _, problem := range problems {
+			fmt.Printf("Warning: %v\n", problem)
+		}
+
+	default:
+		fmt.Printf("Error: unknown config command '%s'\n", params[0])
+		os.Exit(1)
+	}
 }
 
 func HandleHelp(params []string, flags map[string]string) {
@@ -259,10 +1124,51 @@ func HandleHelp(params []string, flags map[string]string) {
 Usage:
   punjado [path]        Open TUI in directory
   punjado open [path]   Open TUI in directory
-  punjado add <files>   Add files to context
-  punjado remove <files> Remove files from context
+  punjado add <files>   Add files to context (file:10-80,120-140 for lines)
+  punjado add <files> --priority <N>
+                        Add files with a priority for --sort priority
+  punjado add <files> --outline
+                        Add files as their outline: imports, types and
+                        signatures instead of the whole file
+  punjado add <files> --symbols <names>
+                        Add only the named top-level declarations of Go
+                        files, comma separated, Type.Method for methods
+                        and name#2 for the second of a repeated name
+  punjado add --glob <pattern> [--exclude <pattern>]
+                        Add all files matching a glob (or --regex <expr>)
+  punjado add --deps <file.go> [--depth N] [--reverse]
+                        Add Go files with the module packages they import, or
+                        with --reverse the files importing their package
+  punjado remove <files> Remove files from context (flags: --glob, --regex, --exclude)
   punjado toggle <file> Toggle file context
-  punjado list          List selected files
-  punjado copy          Copy context to clipboard (flags: --std)
-  punjado git           Add all changed git files`)
+  punjado list          List selected files (flags: --sort)
+  punjado copy          Copy context to clipboard (flags: --stdout, --budget,
+                        --format plain|xml|markdown|json|jsonl, --template <file>,
+                        --sort insertion|path|deps|priority,
+                        --tree, --tree-depth <N>)
+  punjado git [status]  Add all changed git files (flags: --staged, --unstaged,
+                        --untracked)
+  punjado git diff [--staged] [<rev-range>] [--base <branch>] [--full]
+                        Copy the changes as unified diffs, with --full followed
+                        by the changed files (flags as for copy)
+  punjado git commits <rev-range> [--messages]
+                        Add the files changed by a commit or a range of commits,
+                        with --messages their messages go in front of the copy
+  punjado git branch [--base <branch>] [--messages]
+                        Add the files changed on the branch since it left
+                        main, or --base
+  punjado tokens        Count tokens of the selected files (flags: --sort, --json)
+  punjado profile save|load|list|delete <name>
+                        Manage named selections
+  punjado profile diff <a> [b]
+                        Show files that differ between two profiles
+  punjado budget [set <tokens|preset>|mode warn|hard|clear|presets]
+                        Show or change the token budget (flags: --profile)
+  punjado config get|set|list|edit [key] [value]
+                        Show or change settings (flags: --global)
+  punjado history       List previous selections
+  punjado history restore <N>
+                        Restore a previous selection
+  punjado ignore add|remove|list <pattern>
+                        Manage the .punjadoignore patterns`)
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/atotto/clipboard"
+)
+
+// copyToClipboard writes text to the clipboard with the configured backend.
+// "auto" lets the clipboard package pick whatever tool is installed.
+func copyToClipboard(text string, backend string) error {
+	switch backend {
+	case "auto", "":
+		return clipboard.WriteAll(text)
+	case "xclip":
+		return pipeToCommand(text, "xclip", "-selection", "clipboard")
+	case "xsel":
+		return pipeToCommand(text, "xsel", "--clipboard", "--input")
+	case "wl-copy":
+		return pipeToCommand(text, "wl-copy")
+	case "pbcopy":
+		return pipeToCommand(text, "pbcopy")
+	case "clip":
+		return pipeToCommand(text, "clip.exe")
+	case "osc52":
+		return writeOSC52(text)
+	}
+	return fmt.Errorf("unknown clipboard backend '%s'", backend)
+}
+
+func pipeToCommand(text string, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+// writeOSC52 asks the terminal to set the clipboard, which also works over
+// ssh. The sequence goes to the terminal directly so piped output stays clean.
+func writeOSC52(text string) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		tty = os.Stderr
+	} else {
+		defer tty.Close()
+	}
+	_, err = fmt.Fprintf(tty, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return err
+}
@@ -1,6 +1,15 @@
 package main
 
 import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
 )
 
 
@@ -12,15 +21,31 @@ type Action struct {
 func (m model) commit(action Action) model {
 	action.Redo() 
 	
+	// A new action after the undo stack was used up starts from the most
+	// recent entry of the history again.
+	if len(m.undoStack) == 0 {
+		m.historyPos = len(m.history) - 1
+	}
 	m.undoStack = append(m.undoStack, action)
 	m.redoStack = nil 
 	
-	saveState(m.root, m.root.Path)
+	return m.save()
+}
+
+// save writes the selection and adds it to the history journal.
+func (m model) save() model {
+	selected := saveState(m.root, m.root.Path)
+	count := len(m.history)
+	m.history = recordHistory(m.root.Path, m.history, selected)
+	// Cutting the journal back drops entries from its start.
+	if len(m.history) < count {
+		m.historyPos -= count + 1 - len(m.history)
+	}
 	return m
 }
 
 func (m model) performUndo() model {
-	if len(m.undoStack) == 0 { return m }
+	if len(m.undoStack) == 0 { return m.undoFromHistory() }
 
 	lastIdx := len(m.undoStack) - 1
 	action := m.undoStack[lastIdx]
@@ -29,8 +54,31 @@ func (m model) performUndo() model {
 	action.Undo()
 	m.redoStack = append(m.redoStack, action)
 	
-	saveState(m.root, m.root.Path)
-	return m
+	return m.save()
+}
+
+// undoFromHistory steps back to the previous entry of the history journal
+// once the undo stack of the session is used up. The step is pushed to the
+// redo stack like any other action.
+func (m model) undoFromHistory() model {
+	target := m.historyPos - 1
+	if target < 0 || target >= len(m.history) {
+		return m
+	}
+
+	root := m.root
+	current := selectionMap(collectSelection(root, root.Path))
+	snapshot := m.history[target].selectionMap()
+	action := Action{
+		Undo: func() { applySelection(root, root.Path, snapshot) },
+		Redo: func() { applySelection(root, root.Path, current) },
+	}
+
+	action.Undo()
+	m.historyPos = target
+	m.redoStack = append(m.redoStack, action)
+
+	return m.save()
 }
 
 func (m model) performRedo() model {
@@ -43,32 +91,118 @@ func (m model) performRedo() model {
 	action.Redo()
 	m.undoStack = append(m.undoStack, action)
 	
-	saveState(m.root, m.root.Path) 
-	return m
+	return m.save()
 }
 
 func (m model) toggleCurrentFile() model {
-	node := m.visibleNodes[m.cursor]
-	if node.IsBinary {
+	node := m.currentNode()
+	if node == nil || node.IsBinary || node.Ignored {
 		return m 
 	}
+	if node.Symbol != "" {
+		return m.toggleSymbol(node)
+	}
 
 	prevState := node.Selected
+	prevRanges := collectRanges(node)
 	newState := !prevState
+	if m.selectedMode && node.SomeSelected {
+		// Everything shown in the selected only view is deselected from
+		// there, a partly selected directory included.
+		newState = false
+	}
 
 	action := Action{
-		Undo: func() { node.SetSelected(prevState) },
+		Undo: func() {
+			node.SetSelected(prevState)
+			restoreRanges(prevRanges)
+		},
 		Redo: func() { node.SetSelected(newState) },
 	}
 
 	return m.commit(action)
 }
 
+// toggleSymbol adds the declaration of a symbol node to the selection of
+// its file or takes it out. A file with all its symbols is selected whole
+// and one without any is deselected.
+func (m model) toggleSymbol(node *FileNode) model {
+	file := node.Parent
+	var symbols []string
+	for _, decl := range file.Decls {
+		if decl.symbolSelected() != (decl == node) {
+			symbols = append(symbols, decl.Symbol)
+		}
+	}
+
+	prevState := file.Selected
+	prevRanges := collectRanges(file)
+
+	action := Action{
+		Undo: func() {
+			file.SetSelected(prevState)
+			restoreRanges(prevRanges)
+		},
+	}
+	switch len(symbols) {
+	case 0:
+		action.Redo = func() { file.SetSelected(false) }
+	case len(file.Decls):
+		action.Redo = func() {
+			file.SetSelected(true)
+			file.setState(fileState{})
+		}
+	default:
+		action.Redo = func() {
+			file.SetSelected(true)
+			file.setState(fileState{Symbols: symbols})
+		}
+	}
+
+	return m.commit(action)
+}
+
+// cycleOutline cycles the current file from excluded to full to outline and
+// back to excluded. Files without an outline skip it.
+func (m model) cycleOutline() model {
+	node := m.currentFile()
+	if node == nil || node.IsDir || node.IsBinary || node.Ignored {
+		return m
+	}
+	outlineErr := outlineError(node.Path)
+
+	prevState := node.Selected
+	prevRanges := collectRanges(node)
+
+	action := Action{
+		Undo: func() {
+			node.SetSelected(prevState)
+			restoreRanges(prevRanges)
+		},
+	}
+	switch {
+	case !prevState:
+		action.Redo = func() { node.SetSelected(true) }
+	case !node.Outline && outlineErr == nil:
+		action.Redo = func() {
+			node.setState(fileState{Outline: true})
+		}
+	default:
+		action.Redo = func() { node.SetSelected(false) }
+	}
+
+	m = m.commit(action)
+	if outlineErr != nil && prevState {
+		m = m.showToast("No outline for " + node.Name)
+	}
+	return m
+}
+
 func (m model) toggleAllFiles() model {
 	allSelected := true
 	for _, node := range m.visibleNodes {
 		emptyDir := node.IsDir && len(node.Children) == 0
-		if node.IsBinary || emptyDir { continue }
+		if node.IsBinary || node.Ignored || emptyDir || node.Symbol != "" { continue }
 		if !node.Selected {
 			allSelected = false
 			break
@@ -78,19 +212,23 @@ func (m model) toggleAllFiles() model {
 
 	prevStates := make(map[*FileNode]bool)
 	for _, node := range m.visibleNodes {
-		prevStates[node] = node.Selected
+		if node.Symbol == "" {
+			prevStates[node] = node.Selected
+		}
 	}
+	prevRanges := collectRanges(m.root)
 
 	action := Action{
 		Undo: func() {
 			for node, oldState := range prevStates {
 				node.SetSelected(oldState)
 			}
+			restoreRanges(prevRanges)
 		},
 		Redo: func() {
 			for node := range prevStates {
 				emptyDir := node.IsDir && len(node.Children) == 0
-				if node.IsBinary || emptyDir { continue }
+				if node.IsBinary || node.Ignored || emptyDir { continue }
 				node.SetSelected(targetState)
 			}
 		},
@@ -149,34 +287,72 @@ func (m model) gotoBottom() model {
 
 func (m model) toggleHelp() model {
 	m.helpMode = !m.helpMode
-	headerHeight := 1
-	footerHeight := 1
-	if m.helpMode {
-		footerHeight = 10
-	}
-	m.viewport.Height = m.height - headerHeight - footerHeight
-	return m
+	return m.resizeViewport()
 }
 
+// closeHelp closes the help panel, or clears the search when the help is
+// not open.
 func (m model) closeHelp() model {
 	if m.helpMode {
 		m.helpMode = false
-		headerHeight := 1
-		footerHeight := 2
-		m.viewport.Height = m.height - headerHeight - footerHeight
+		return m.resizeViewport()
+	}
+	return m.clearSearch()
+}
+
+// resizeViewport fits the viewport between the header and the footer, which
+// grows with the help panel while it is open.
+func (m model) resizeViewport() model {
+	headerHeight := 1
+	footer := m.ViewFooter()
+	if m.helpMode {
+		footer = m.ViewExpandedHelp()
 	}
+	footerHeight := strings.Count(footer, "\n")
+	m.viewport.Height = max(m.height-headerHeight-footerHeight, 0)
+	m.viewport.Width = m.treeWidth()
 	return m
 }
 
+// toggleSelectedMode switches between the whole tree and the view of only
+// the selected files, keeping the cursor on the same node if it can.
+func (m model) toggleSelectedMode() model {
+	current := m.currentNode()
+	m.selectedMode = !m.selectedMode
+	m = m.refreshVisible()
+	m = m.cursorTo(current)
+	return m.scrollToCursor()
+}
+
 func (m model) toggleDirectory() model {
-	node := m.visibleNodes[m.cursor]
-	if node.IsDir {
+	node := m.currentNode()
+	if node != nil && node.IsDir {
 		node.ToggleExpand()
-		m.visibleNodes = flattenVisible(m.root)
+		m = m.refreshVisible()
+	}
+	if file := m.currentFile(); file != nil && file.hasSymbols() && !m.selectedMode {
+		m = m.toggleSymbols(file)
 	}
 	return m
 }
 
+// toggleSymbols expands a Go file into its top-level declarations, read
+// again every time it opens, or collapses it with the cursor on the file.
+func (m model) toggleSymbols(node *FileNode) model {
+	if !node.Expanded {
+		if err := node.loadSymbols(); err != nil {
+			return m.showToast("Can't read symbols: " + err.Error())
+		}
+		if len(node.Decls) == 0 {
+			return m.showToast("No declarations in " + node.Name)
+		}
+	}
+	node.Expanded = !node.Expanded
+	m = m.refreshVisible()
+	m = m.cursorTo(node)
+	return m.scrollToCursor()
+}
+
 func (m model) toggleExpandAll() model {
 	allNodesExpanded := true
 	for _, node := range m.visibleNodes {
@@ -191,6 +367,312 @@ func (m model) toggleExpandAll() model {
 			node.Expanded = !allNodesExpanded
 		}
 	}
-	m.visibleNodes = flattenVisible(m.root)
+	return m.refreshVisible()
+}
+
+func (m model) toggleIgnored() model {
+	m.showIgnored = !m.showIgnored
+	if m.showIgnored {
+		loadIgnored(m.root)
+	}
+	if m.searchQuery != "" {
+		return m.updateSearch(m.searchQuery)
+	}
+	return m.refreshVisible()
+}
+
+func (m model) openProfilePicker() model {
+	m.profileNames = listProfiles(m.root.Path)
+	m.profileCursor = 0
+	m.profileMode = true
+	return m
+}
+
+func (m model) updateProfilePicker(keyStr string) model {
+	switch keyStr {
+	case "j", "<down>":
+		if m.profileCursor < len(m.profileNames)-1 {
+			m.profileCursor++
+		}
+	case "k", "<up>":
+		if m.profileCursor > 0 {
+			m.profileCursor--
+		}
+	case "<enter>":
+		m = m.loadPickedProfile()
+	case "<esc>", "q", "P":
+		m.profileMode = false
+	}
+	return m
+}
+
+func (m model) loadPickedProfile() model {
+	m.profileMode = false
+	if len(m.profileNames) == 0 {
+		return m
+	}
+	name := m.profileNames[m.profileCursor]
+	selection, err := readProfile(m.root.Path, name)
+	if err != nil {
+		log.Printf("Loading profile '%s' failed: %v", name, err)
+		return m
+	}
+
+	// The profile brings its own settings, like the token budget.
+	if settings, err := readProfileSettings(m.root.Path, name); err == nil {
+		writeSettings(m.root.Path, settings)
+		if budget, err := resolveBudget(m.config, settings); err == nil {
+			m.budget = budget
+		}
+	}
+
+	root := m.root
+	prev := selectionMap(collectSelection(root, root.Path))
+	action := Action{
+		Undo: func() { applySelection(root, root.Path, prev) },
+		Redo: func() { applySelection(root, root.Path, selection) },
+	}
+	return m.commit(action)
+}
+
+// openPrompt asks for a line of input in the footer and hands it to submit
+// on enter. Esc cancels.
+func (m model) openPrompt(label string, submit func(model, string) model, hint func(model, string) string) model {
+	input := textinput.New()
+	input.Prompt = " "
+	input.Cursor.SetMode(cursor.CursorStatic)
+	input.Focus()
+
+	m.promptMode = true
+	m.promptLabel = label
+	m.promptInput = input
+	m.promptSubmit = submit
+	m.promptHint = hint
+	m.promptChange = nil
+	m.promptCancel = nil
+	return m
+}
+
+func (m model) updatePrompt(msg tea.KeyMsg) model {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.promptMode = false
+		if m.promptCancel != nil {
+			m = m.promptCancel(m)
+		}
+	case tea.KeyEnter:
+		m.promptMode = false
+		m = m.promptSubmit(m, m.promptInput.Value())
+	default:
+		value := m.promptInput.Value()
+		m.promptInput, _ = m.promptInput.Update(msg)
+		if m.promptChange != nil && m.promptInput.Value() != value {
+			m = m.promptChange(m, m.promptInput.Value())
+		}
+	}
+	return m
+}
+
+func (m model) openSelectPattern() model {
+	return m.openPrompt("select", func(m model, query string) model {
+		return m.selectPattern(query, true)
+	}, model.patternHint)
+}
+
+func (m model) openDeselectPattern() model {
+	return m.openPrompt("deselect", func(m model, query string) model {
+		return m.selectPattern(query, false)
+	}, model.patternHint)
+}
+
+func (m model) patternHint(query string) string {
+	if strings.TrimSpace(query) == "" {
+		return "glob, re:regex, !exclude"
+	}
+	matcher, err := parsePatternQuery(query)
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("%d files", len(matcher.Files(m.root, m.root.Path)))
+}
+
+func (m model) selectDeps() model {
+	return m.selectGoDeps(false)
+}
+
+func (m model) selectDependents() model {
+	return m.selectGoDeps(true)
+}
+
+// selectGoDeps selects the Go file under the cursor with the files of the
+// packages it imports, or with reverse the files importing its package, as
+// a single action. deps.depth limits how far imports are followed.
+func (m model) selectGoDeps(reverse bool) model {
+	node := m.currentFile()
+	if node == nil || node.IsDir || !strings.HasSuffix(node.Name, ".go") {
+		return m.showToast("Not a Go file")
+	}
+	depth, err := strconv.Atoi(m.config.Get("deps.depth"))
+	if err != nil || depth < 0 {
+		return m.showToast(fmt.Sprintf("Invalid deps.depth '%s'", m.config.Get("deps.depth")))
+	}
+	deps, err := goDeps([]string{node.Path}, depth, reverse)
+	if err != nil {
+		return m.showToast(err.Error())
+	}
+
+	root, err := filepath.Abs(m.root.Path)
+	if err != nil {
+		return m.showToast(err.Error())
+	}
+	files := []*FileNode{node}
+	for _, path := range deps {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if dep := findNode(m.root, filepath.Join(m.root.Path, rel)); dep != nil && !dep.Ignored {
+			files = append(files, dep)
+		}
+	}
+	m = m.selectFiles(files, true)
+	if reverse {
+		return m.showToast(fmt.Sprintf("Selected %s with %d dependents", node.Name, len(files)-1))
+	}
+	return m.showToast(fmt.Sprintf("Selected %s with %d imported files", node.Name, len(files)-1))
+}
+
+// selectPattern selects or deselects every file matching query as a single
+// action, so one undo reverts all of it.
+func (m model) selectPattern(query string, selected bool) model {
+	matcher, err := parsePatternQuery(query)
+	if err != nil {
+		return m.showToast(fmt.Sprintf("Invalid pattern: %v", err))
+	}
+
+	return m.selectFiles(matcher.Files(m.root, m.root.Path), selected)
+}
+
+// selectFiles selects or deselects the given files as a single action.
+func (m model) selectFiles(files []*FileNode, selected bool) model {
+	root := m.root
+	prev := selectionMap(collectSelection(root, root.Path))
+	next := selectionMap(collectSelection(root, root.Path))
+	for _, node := range files {
+		rel, err := filepath.Rel(root.Path, node.Path)
+		if err != nil {
+			continue
+		}
+		if !selected {
+			delete(next, rel)
+		} else if _, ok := next[rel]; !ok {
+			next[rel] = Selection{Path: rel}
+		}
+	}
+
+	action := Action{
+		Undo: func() { applySelection(root, root.Path, prev) },
+		Redo: func() { applySelection(root, root.Path, next) },
+	}
+	return m.commit(action)
+}
+
+// contextForCopy builds the text punjado copy produces for the current
+// selection.
+func (m model) contextForCopy() (text string, files int, tokens int, err error) {
+	selected, err := sortSelection(m.root.Path, readSelection(m.root.Path), m.config.Get("output.sort"))
+	if err != nil {
+		return "", 0, 0, err
+	}
+	tree, err := contextTree(m.root, m.config)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	text, files, err = buildContext(m.root.Path, selected, tree, m.config)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return text, files, defaultTokenizer().Count(text), nil
+}
+
+func (m model) copyContext() model {
+	text, files, tokens, err := m.contextForCopy()
+	if err != nil {
+		return m.showToast(err.Error())
+	}
+	return m.copyText(text, files, tokens)
+}
+
+func (m model) copyText(text string, files int, tokens int) model {
+	if files == 0 {
+		return m.showToast("Nothing selected")
+	}
+	if m.budget.Hard && m.budget.Exceeded(tokens) {
+		return m.showToast(fmt.Sprintf("Not copied: %d tokens, over the budget of %d", tokens, m.budget.Limit))
+	}
+	if err := copyToClipboard(text, m.config.Get("clipboard.backend")); err != nil {
+		log.Printf("Copy failed: %v", err)
+		return m.showToast("Copy failed: " + err.Error())
+	}
+
+	msg := fmt.Sprintf("Copied %d files (%d tokens)", files, tokens)
+	if m.budget.Exceeded(tokens) {
+		msg += ", over budget"
+	}
+	return m.showToast(msg)
+}
+
+func (m model) showToast(msg string) model {
+	m.toast = msg
+	m.toastID++
+	return m
+}
+
+func (m model) openPreview() model {
+	text, files, tokens, err := m.contextForCopy()
+	if err != nil {
+		return m.showToast(err.Error())
+	}
+	m.previewText, m.previewFiles, m.previewTokens = text, files, tokens
+	m.previewOffset = m.viewport.YOffset
+	m.previewMode = true
+	m.viewport.SetContent(m.renderContent())
+	m.viewport.GotoTop()
+	return m
+}
+
+func (m model) closePreview() model {
+	m.previewMode = false
+	m.previewText = ""
+	m.viewport.SetContent(m.renderContent())
+	m.viewport.SetYOffset(m.previewOffset)
+	return m
+}
+
+func (m model) updatePreview(keyStr string) model {
+	switch keyStr {
+	case "j", "<down>":
+		m.viewport.ScrollDown(1)
+	case "k", "<up>":
+		m.viewport.ScrollUp(1)
+	case "<ctrl+d>":
+		m.viewport.HalfPageDown()
+	case "<ctrl+u>":
+		m.viewport.HalfPageUp()
+	case "<pgdown>", " ":
+		m.viewport.PageDown()
+	case "<pgup>":
+		m.viewport.PageUp()
+	case "g":
+		m.viewport.GotoTop()
+	case "G":
+		m.viewport.GotoBottom()
+	case "y", "<enter>":
+		text, files, tokens := m.previewText, m.previewFiles, m.previewTokens
+		m = m.closePreview()
+		m = m.copyText(text, files, tokens)
+	case "<esc>", "q", "Y":
+		m = m.closePreview()
+	}
 	return m
 }
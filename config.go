@@ -0,0 +1,478 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Settings are read from a small subset of TOML: [sections], key = value
+// pairs with strings, numbers, booleans and arrays of strings, and comments.
+// Keys are addressed as "section.key".
+const projectConfigName = ".punjado.toml"
+
+type configKey struct {
+	Name    string
+	Default string
+	List    bool
+	Help    string
+}
+
+var configKeys = []configKey{
+	{Name: "output.format", Default: "plain", Help: "plain, xml, markdown, json or jsonl"},
+	{Name: "output.template", Help: "text/template file used instead of the format"},
+	{Name: "output.sort", Default: "insertion", Help: "insertion, path, deps or priority"},
+	{Name: "tree.enabled", Default: "false", Help: "put the project tree in front of the copied files"},
+	{Name: "tree.depth", Default: "4", Help: "directory levels of the tree, 0 for all"},
+	{Name: "tree.collapse", Default: "20", Help: "directories with more entries only show selected ones"},
+	{Name: "deps.depth", Default: "1", Help: "levels of imports add --deps follows, 0 for all"},
+	{Name: "budget.limit", Default: strconv.Itoa(defaultBudget), Help: "token budget, a number, 128k or a model preset"},
+	{Name: "budget.mode", Default: "warn", Help: "warn or hard when the budget is exceeded"},
+	{Name: "ignore.patterns", List: true, Help: "extra gitignore style patterns"},
+	{Name: "clipboard.backend", Default: "auto", Help: "auto, xclip, xsel, wl-copy, pbcopy, clip, osc52"},
+	{Name: "theme.accent", Default: "#7D56F4", Help: "header color"},
+	{Name: "theme.text", Default: "#FAFAFA", Help: "file color"},
+	{Name: "theme.muted", Default: "#909090", Help: "binary, ignored and empty entries"},
+	{Name: "theme.selected", Default: "#B8BB26", Help: "selected files"},
+	{Name: "theme.partial", Default: "#83A598", Help: "partially selected files"},
+	{Name: "theme.someSelected", Default: "#ffa000", Help: "directories with some files selected"},
+	{Name: "theme.cursor", Default: "#444", Help: "cursor line background"},
+	{Name: "theme.warning", Default: "#E03A3E", Help: "token count over budget"},
+}
+
+// configFlags maps command line flags to the setting they override.
+var configFlags = map[string]string{
+	"budget":     "budget.limit",
+	"clipboard":  "clipboard.backend",
+	"format":     "output.format",
+	"template":   "output.template",
+	"tree":       "tree.enabled",
+	"tree-depth": "tree.depth",
+	"depth":      "deps.depth",
+}
+
+func findConfigKey(name string) (configKey, bool) {
+	for _, k := range configKeys {
+		if k.Name == name {
+			return k, true
+		}
+	}
+	// Keymaps are free form, one list of keys per command.
+	if strings.HasPrefix(name, "keymaps.") && len(name) > len("keymaps.") {
+		return configKey{Name: name, List: true, Help: "keys bound to the command"}, true
+	}
+	return configKey{}, false
+}
+
+// validateConfigValue checks the settings that only accept some values.
+func validateConfigValue(key string, v configValue) error {
+	switch key {
+	case "output.format":
+		if _, ok := outputFormats[v.Value]; !ok {
+			return fmt.Errorf("unknown output format '%s'", v.Value)
+		}
+	case "output.sort":
+		if !slices.Contains(selectionSorts, v.Value) {
+			return fmt.Errorf("unknown sort '%s'", v.Value)
+		}
+	case "tree.enabled":
+		if v.Value != "true" && v.Value != "false" {
+			return fmt.Errorf("tree.enabled must be true or false")
+		}
+	case "tree.depth", "tree.collapse", "deps.depth":
+		if n, err := strconv.Atoi(v.Value); err != nil || n < 0 {
+			return fmt.Errorf("%s must be a number of 0 or more", key)
+		}
+	case "budget.limit":
+		_, err := parseBudget(v.Value)
+		return err
+	case "budget.mode":
+		_, err := parseBudgetMode(v.Value)
+		return err
+	case "clipboard.backend":
+		switch v.Value {
+		case "auto", "xclip", "xsel", "wl-copy", "pbcopy", "clip", "osc52":
+		default:
+			return fmt.Errorf("unknown clipboard backend '%s'", v.Value)
+		}
+	}
+	return nil
+}
+
+// checkConfigValue checks a setting read from a config file: the key has to
+// be known and the value of its kind and accepted by validateConfigValue.
+func checkConfigValue(key string, v configValue) error {
+	k, ok := findConfigKey(key)
+	if !ok {
+		return fmt.Errorf("unknown key '%s'", key)
+	}
+	if v.IsList != k.List {
+		if k.List {
+			return fmt.Errorf("%s must be an array of strings", key)
+		}
+		return fmt.Errorf("%s must not be an array", key)
+	}
+	return validateConfigValue(key, v)
+}
+
+type configValue struct {
+	Value  string
+	List   []string
+	IsList bool
+	Source string
+}
+
+func (v configValue) String() string {
+	if v.IsList {
+		quoted := make([]string, len(v.List))
+		for i, item := range v.List {
+			quoted[i] = strconv.Quote(item)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+	return v.Value
+}
+
+// Config is the merged view of all settings. Later layers win: defaults,
+// the global config file, the project config file, environment variables
+// (PUNJADO_SECTION_KEY) and command line flags.
+type Config struct {
+	values map[string]configValue
+}
+
+func globalConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "punjado", "config")
+}
+
+func projectConfigPath(dir string) string {
+	return filepath.Join(dir, projectConfigName)
+}
+
+func loadConfig(dir string, flags map[string]string) *Config {
+	c := &Config{values: make(map[string]configValue)}
+	for _, k := range configKeys {
+		c.values[k.Name] = configValue{Value: k.Default, IsList: k.List, Source: "default"}
+	}
+
+	for _, layer := range []struct{ path, source string }{
+		{globalConfigPath(), "global"},
+		{projectConfigPath(dir), "project"},
+	} {
+		if layer.path == "" {
+			continue
+		}
+		values, problems, err := readConfigFile(layer.path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				warnConfig(err)
+			}
+			continue
+		}
+		for _, problem := range problems {
+			warnConfig(problem)
+		}
+		for key, v := range values {
+			v.Source = layer.source
+			c.values[key] = v
+		}
+	}
+
+	for key, v := range c.values {
+		env := "PUNJADO_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+		if value, ok := os.LookupEnv(env); ok {
+			c.values[key] = parseOverride(value, v.IsList, "env")
+		}
+	}
+
+	for flag, key := range configFlags {
+		if value, ok := flags[flag]; ok {
+			// Flags without a parameter switch a setting on.
+			if value == "" {
+				value = "true"
+			}
+			c.values[key] = parseOverride(value, c.values[key].IsList, "flag")
+		}
+	}
+	return c
+}
+
+// configWarned holds the config problems reported so far, so a file that is
+// loaded several times in one run is only complained about once.
+var configWarned = make(map[string]bool)
+
+func warnConfig(err error) {
+	if !configWarned[err.Error()] {
+		configWarned[err.Error()] = true
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+func parseOverride(value string, isList bool, source string) configValue {
+	if !isList {
+		return configValue{Value: value, Source: source}
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return configValue{List: list, IsList: true, Source: source}
+}
+
+func (c *Config) Get(key string) string {
+	return c.values[key].Value
+}
+
+func (c *Config) GetList(key string) []string {
+	return c.values[key].List
+}
+
+// IsOverridden reports whether key was set by an environment variable or a
+// command line flag.
+func (c *Config) IsOverridden(key string) bool {
+	source := c.values[key].Source
+	return source == "env" || source == "flag"
+}
+
+func (c *Config) Lookup(key string) (configValue, bool) {
+	v, ok := c.values[key]
+	return v, ok
+}
+
+// Keys returns every key with a value, sorted.
+func (c *Config) Keys() []string {
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readConfigFile reads the settings of the config file at path. Unknown keys
+// and values a setting doesn't accept are left out and returned as problems,
+// a file that can't be parsed is an error.
+func readConfigFile(path string) (map[string]configValue, []error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make(map[string]configValue)
+	var problems []error
+	section := ""
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(stripComment(lines[i]))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		key, raw, found := strings.Cut(line, "=")
+		if !found {
+			return nil, nil, fmt.Errorf("%s:%d: expected key = value", path, i+1)
+		}
+		key = strings.TrimSpace(key)
+		raw = strings.TrimSpace(raw)
+		start := i + 1
+		// Arrays may span several lines.
+		for strings.HasPrefix(raw, "[") && !strings.HasSuffix(raw, "]") && i+1 < len(lines) {
+			i++
+			raw += " " + strings.TrimSpace(stripComment(lines[i]))
+		}
+
+		v, err := parseConfigValue(raw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s:%d: %v", path, i+1, err)
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+		if err := checkConfigValue(key, v); err != nil {
+			problems = append(problems, fmt.Errorf("%s:%d: %v", path, start, err))
+			continue
+		}
+		values[key] = v
+	}
+	return values, problems, nil
+}
+
+// stripComment drops a trailing # comment that is not inside a string.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func parseConfigValue(raw string) (configValue, error) {
+	if strings.HasPrefix(raw, "[") {
+		if !strings.HasSuffix(raw, "]") {
+			return configValue{}, fmt.Errorf("unterminated array")
+		}
+		list := []string{}
+		for _, item := range splitArray(raw[1 : len(raw)-1]) {
+			s, err := parseConfigScalar(item)
+			if err != nil {
+				return configValue{}, err
+			}
+			list = append(list, s)
+		}
+		return configValue{List: list, IsList: true}, nil
+	}
+	s, err := parseConfigScalar(raw)
+	return configValue{Value: s}, err
+}
+
+func parseConfigScalar(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		s, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return s, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	case raw == "true" || raw == "false":
+		return raw, nil
+	}
+	if _, err := strconv.ParseFloat(strings.ReplaceAll(raw, "_", ""), 64); err == nil {
+		return strings.ReplaceAll(raw, "_", ""), nil
+	}
+	return "", fmt.Errorf("invalid value %s", raw)
+}
+
+// splitArray splits the inside of an array on commas outside of strings.
+func splitArray(inner string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(inner); i++ {
+		c := inner[i]
+		switch {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ',':
+			items = append(items, inner[start:i])
+			start = i + 1
+		}
+	}
+	items = append(items, inner[start:])
+
+	var trimmed []string
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			trimmed = append(trimmed, item)
+		}
+	}
+	return trimmed
+}
+
+func formatConfigValue(v configValue) string {
+	if v.IsList {
+		return v.String()
+	}
+	if v.Value == "true" || v.Value == "false" {
+		return v.Value
+	}
+	if _, err := strconv.Atoi(v.Value); err == nil {
+		return v.Value
+	}
+	return strconv.Quote(v.Value)
+}
+
+// setConfigFileValue writes key = value into the config file at path,
+// replacing an existing assignment or adding it to its section. Everything
+// else in the file is left untouched.
+func setConfigFileValue(path string, key string, v configValue) error {
+	section, name := "", key
+	if i := strings.LastIndex(key, "."); i != -1 {
+		section, name = key[:i], key[i+1:]
+	}
+	assignment := name + " = " + formatConfigValue(v)
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+	if len(data) == 0 {
+		lines = nil
+	}
+
+	current := ""
+	sectionEnd := -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(stripComment(line))
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			current = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			if current == section {
+				sectionEnd = i
+			}
+			continue
+		}
+		if current != section {
+			continue
+		}
+		if trimmed != "" {
+			sectionEnd = i
+		}
+		if k, _, found := strings.Cut(trimmed, "="); found && strings.TrimSpace(k) == name {
+			lines[i] = assignment
+			return writeConfigLines(path, lines)
+		}
+	}
+
+	switch {
+	case sectionEnd != -1:
+		lines = append(lines[:sectionEnd+1], append([]string{assignment}, lines[sectionEnd+1:]...)...)
+	case section == "":
+		lines = append([]string{assignment}, lines...)
+	default:
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+section+"]", assignment)
+	}
+	return writeConfigLines(path, lines)
+}
+
+func writeConfigLines(path string, lines []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	content := strings.TrimRight(strings.Join(lines, "\n"), "\n") + "\n"
+	return os.WriteFile(path, []byte(content), 0644)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		want     map[string]configValue
+		problems []string
+		wantErr  bool
+	}{
+		{
+			name:    "sections, scalars and comments",
+			content: "# settings\n[output]\nformat = \"xml\" # inline\nsort = 'path'\n\n[tree]\nenabled = true\ndepth = 1_0\n",
+			want: map[string]configValue{
+				"output.format": {Value: "xml"},
+				"output.sort":   {Value: "path"},
+				"tree.enabled":  {Value: "true"},
+				"tree.depth":    {Value: "10"},
+			},
+		},
+		{
+			name:    "arrays over several lines",
+			content: "[ignore]\npatterns = [\n  \"*.log\", # logs\n  'a,b',\n]\n[keymaps]\ntoggle = [\"x\"]\n",
+			want: map[string]configValue{
+				"ignore.patterns": {List: []string{"*.log", "a,b"}, IsList: true},
+				"keymaps.toggle":  {List: []string{"x"}, IsList: true},
+			},
+		},
+		{
+			name:    "hash inside a string",
+			content: "[theme]\naccent = \"#123456\"\n",
+			want:    map[string]configValue{"theme.accent": {Value: "#123456"}},
+		},
+		{
+			name:     "unknown keys and sections",
+			content:  "[output]\nformt = \"xml\"\n[copy]\nformat = \"xml\"\n[budget]\nmode = \"hard\"\n",
+			want:     map[string]configValue{"budget.mode": {Value: "hard"}},
+			problems: []string{"2: unknown key 'output.formt'", "4: unknown key 'copy.format'"},
+		},
+		{
+			name:     "invalid values",
+			content:  "[budget]\nlimit = \"lots\"\n[output]\nformat = \"yaml\"\n[tree]\ndepth = -1\nenabled = \"yes\"\n",
+			want:     map[string]configValue{},
+			problems: []string{"2: invalid token budget 'lots'", "4: unknown output format 'yaml'", "6: tree.depth", "7: tree.enabled"},
+		},
+		{
+			name:     "wrong kind of value",
+			content:  "[ignore]\npatterns = \"*.log\"\n[output]\nsort = [\n\"path\"\n]\n",
+			want:     map[string]configValue{},
+			problems: []string{"2: ignore.patterns must be an array", "4: output.sort must not be an array"},
+		},
+		{name: "missing equals sign", content: "[output]\nformat\n", wantErr: true},
+		{name: "bare word", content: "format = xml\n", wantErr: true},
+		{name: "unterminated array", content: "[ignore]\npatterns = [\"a\"\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), projectConfigName)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			values, problems, err := readConfigFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(values, tt.want) {
+				t.Errorf("values = %+v, want %+v", values, tt.want)
+			}
+			if len(problems) != len(tt.problems) {
+				t.Fatalf("problems = %v, want %d", problems, len(tt.problems))
+			}
+			for i, problem := range problems {
+				if want := path + ":" + tt.problems[i]; !strings.HasPrefix(problem.Error(), want) {
+					t.Errorf("problem %d = %q, want it to start with %q", i, problem, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	isolateUserConfig(t)
+	dir := t.TempDir()
+	writeConfig := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig(globalConfigPath(), "[output]\nformat = \"xml\"\nsort = \"path\"\n[tree]\ndepth = 2\n[budget]\nlimit = \"lots\"\n")
+	writeConfig(projectConfigPath(dir), "[output]\nformat = \"markdown\"\n[tree]\ndepth = 3\n")
+	t.Setenv("PUNJADO_TREE_DEPTH", "5")
+	t.Setenv("PUNJADO_IGNORE_PATTERNS", "a, b,,")
+
+	cfg := loadConfig(dir, map[string]string{"tree": "", "budget": "1000"})
+	tests := []struct {
+		key    string
+		value  string
+		source string
+	}{
+		{"output.template", "", "default"},
+		{"output.sort", "path", "global"},
+		{"output.format", "markdown", "project"},
+		{"budget.limit", "1000", "flag"},
+		{"budget.mode", "warn", "default"},
+		{"tree.depth", "5", "env"},
+		{"tree.enabled", "true", "flag"},
+	}
+	for _, tt := range tests {
+		v, ok := cfg.Lookup(tt.key)
+		if !ok || v.Value != tt.value || v.Source != tt.source {
+			t.Errorf("%s = %q (%s), want %q (%s)", tt.key, v.Value, v.Source, tt.value, tt.source)
+		}
+	}
+	if got := cfg.GetList("ignore.patterns"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("ignore.patterns = %q, want [a b]", got)
+	}
+	if !cfg.IsOverridden("tree.depth") || cfg.IsOverridden("output.format") {
+		t.Errorf("IsOverridden: tree.depth %v, output.format %v", cfg.IsOverridden("tree.depth"), cfg.IsOverridden("output.format"))
+	}
+}
+
+func TestSetConfigFileValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), projectConfigName)
+	if err := os.WriteFile(path, []byte("# mine\n[output]\nformat = \"xml\" # keep\n\n[tree]\nenabled = true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		key string
+		v   configValue
+	}{
+		{"output.format", configValue{Value: "json"}},
+		{"output.sort", configValue{Value: "path"}},
+		{"tree.depth", configValue{Value: "3"}},
+		{"ignore.patterns", configValue{List: []string{"*.log", "tmp/"}, IsList: true}},
+	}
+	for _, step := range steps {
+		if err := setConfigFileValue(path, step.key, step.v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, _ := os.ReadFile(path)
+	want := "# mine\n[output]\nformat = \"json\"\nsort = \"path\"\n\n[tree]\nenabled = true\ndepth = 3\n\n[ignore]\npatterns = [\"*.log\", \"tmp/\"]\n"
+	if string(data) != want {
+		t.Errorf("file = %q, want %q", data, want)
+	}
+
+	values, problems, err := readConfigFile(path)
+	if err != nil || len(problems) > 0 {
+		t.Fatalf("reading it back: %v %v", err, problems)
+	}
+	for _, step := range steps {
+		if !reflect.DeepEqual(values[step.key], step.v) {
+			t.Errorf("%s = %+v, want %+v", step.key, values[step.key], step.v)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// contextFile is a selected file as it goes into the copied context. Chunks
+// holds the text of each of Ranges, or the whole file when Ranges is nil.
+// When Diff is set the content is the unified diff of the file instead,
+// with Outline its outline and with Symbols the named declarations.
+type contextFile struct {
+	Path     string
+	Language string
+	Ranges   []LineRange
+	Chunks   []string
+	Diff     bool
+	Outline  bool
+	Symbols  []string
+	Err      error
+}
+
+func (f contextFile) Content() string {
+	return strings.Join(f.Chunks, "")
+}
+
+// collectContextFiles reads the selected files of the project in dir, in
+// the given order. Ignored files are left out. The end of each range is
+// clamped to the file and ranges past its end are dropped.
+func collectContextFiles(dir string, selected []Selection) []contextFile {
+	ignore := NewIgnoreMatcher(dir)
+	var files []contextFile
+	for _, sel := range selected {
+		path := sel.Path
+		if ignore.Match(path, false) {
+			continue
+		}
+		file := contextFile{Path: path, Language: languageForPath(path)}
+		content, err := os.ReadFile(filepath.Join(dir, path))
+		switch {
+		case err != nil:
+			file.Err = err
+			file.Ranges = sel.Ranges
+		case sel.Outline && outlineError(path) == nil:
+			file.Outline = true
+			file.Chunks = []string{outlineFile(path, content)}
+		case len(sel.Symbols) > 0:
+			// A file that no longer parses is copied whole.
+			text, err := symbolsFile(content, sel.Symbols)
+			if err != nil {
+				text = string(content)
+			} else {
+				file.Symbols = sel.Symbols
+			}
+			file.Chunks = []string{text}
+		case sel.IsPartial():
+			// Ranges that start past the end of the file are dropped, a file
+			// left without any is reported like a read error.
+			for _, r := range sel.Ranges {
+				text, end := extractRange(content, r)
+				if end < r.Start {
+					continue
+				}
+				file.Ranges = append(file.Ranges, LineRange{Start: r.Start, End: end})
+				file.Chunks = append(file.Chunks, text)
+			}
+			if len(file.Ranges) == 0 {
+				file.Err = fmt.Errorf("lines %s are past the end of the file (%d lines)", formatRanges(sel.Ranges), len(fileLines(content)))
+				file.Ranges = sel.Ranges
+			}
+		default:
+			file.Chunks = []string{string(content)}
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// buildContext assembles the text that is copied for the selection of the
+// project in dir, with the user template of output.template if there is one
+// and in the output.format otherwise. tree is the project tree to include,
+// if any. The commit messages picked with punjado git --messages come first.
+// files is the number of files that made it in.
+func buildContext(dir string, selected []Selection, tree string, cfg *Config) (text string, files int, err error) {
+	return formatContext(dir, collectContextFiles(dir, selected), commitMessages(dir), tree, cfg)
+}
+
+// formatContext renders files like buildContext does.
+func formatContext(dir string, contextFiles []contextFile, commits string, tree string, cfg *Config) (text string, files int, err error) {
+	if path := cfg.Get("output.template"); path != "" {
+		text, err = renderTemplate(path, dir, contextFiles, commits, tree, cfg)
+		return text, len(contextFiles), err
+	}
+
+	format := cfg.Get("output.format")
+	formatter, ok := outputFormats[format]
+	if !ok {
+		return "", 0, fmt.Errorf("unknown output format '%s'", format)
+	}
+	return formatter(commits, tree, contextFiles), len(contextFiles), nil
+}
+
+// projectTree builds the tree of the project in dir with selection marked,
+// when tree.enabled is set.
+func projectTree(dir string, selection map[string]Selection, cfg *Config) (string, error) {
+	if cfg.Get("tree.enabled") != "true" {
+		return "", nil
+	}
+	root, err := buildFileTree(dir)
+	if err != nil {
+		return "", err
+	}
+	applySelection(root, dir, selection)
+	return contextTree(root, cfg)
+}
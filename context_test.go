@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCollectContextFilesRanges(t *testing.T) {
+	isolateUserConfig(t)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "f.txt"), []byte("1\n2\n3\n4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		ranges     []LineRange
+		wantRanges []LineRange
+		wantChunks []string
+		wantErr    bool
+	}{
+		{"inside", []LineRange{{2, 3}}, []LineRange{{2, 3}}, []string{"2\n3\n"}, false},
+		{"end clamped", []LineRange{{3, 10}}, []LineRange{{3, 4}}, []string{"3\n4\n"}, false},
+		{"past the end dropped", []LineRange{{1, 1}, {9, 12}}, []LineRange{{1, 1}}, []string{"1\n"}, false},
+		{"all past the end", []LineRange{{5, 6}}, []LineRange{{5, 6}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := collectContextFiles(dir, []Selection{{Path: "f.txt", Ranges: tt.ranges}})
+			if len(files) != 1 {
+				t.Fatalf("got %d files, want 1", len(files))
+			}
+			f := files[0]
+			if (f.Err != nil) != tt.wantErr {
+				t.Errorf("Err = %v, wantErr %v", f.Err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(f.Ranges, tt.wantRanges) || !reflect.DeepEqual(f.Chunks, tt.wantChunks) {
+				t.Errorf("got ranges %v chunks %q, want %v %q", f.Ranges, f.Chunks, tt.wantRanges, tt.wantChunks)
+			}
+		})
+	}
+}
+
+func TestCollectContextFilesOutline(t *testing.T) {
+	isolateUserConfig(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.go":      "package a\n\nfunc F() {\n\treturn\n}\n",
+		"data.json": "{\"a\": 1}\n",
+	})
+
+	files := collectContextFiles(dir, []Selection{{Path: "a.go", Outline: true}, {Path: "data.json", Outline: true}})
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+	if !files[0].Outline || !reflect.DeepEqual(files[0].Chunks, []string{"package a\n\nfunc F()\n"}) {
+		t.Errorf("a.go: outline %v chunks %q", files[0].Outline, files[0].Chunks)
+	}
+	// A file without an outline is copied whole and not labeled as one.
+	if files[1].Outline || !reflect.DeepEqual(files[1].Chunks, []string{"{\"a\": 1}\n"}) {
+		t.Errorf("data.json: outline %v chunks %q", files[1].Outline, files[1].Chunks)
+	}
+}
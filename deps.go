@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// goModule is the Go module a project belongs to.
+type goModule struct {
+	Root string
+	Path string
+}
+
+// findGoModule looks for the go.mod of dir in dir and its parents.
+func findGoModule(dir string) (goModule, bool) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return goModule{}, false
+	}
+	for {
+		data, err := os.ReadFile(filepath.Join(abs, "go.mod"))
+		if err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "module"); ok {
+					path := strings.Trim(strings.TrimSpace(rest), `"`)
+					return goModule{Root: abs, Path: path}, path != ""
+				}
+			}
+			return goModule{}, false
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return goModule{}, false
+		}
+		abs = parent
+	}
+}
+
+// packageDir returns the directory of an import path of the module.
+func (m goModule) packageDir(importPath string) (string, bool) {
+	if importPath == m.Path {
+		return m.Root, true
+	}
+	rest, ok := strings.CutPrefix(importPath, m.Path+"/")
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(m.Root, filepath.FromSlash(rest)), true
+}
+
+// importPath returns the import path of a package directory of the module.
+func (m goModule) importPath(pkgDir string) (string, bool) {
+	rel, err := filepath.Rel(m.Root, pkgDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if rel == "." {
+		return m.Path, true
+	}
+	return m.Path + "/" + filepath.ToSlash(rel), true
+}
+
+// goFileImports returns the import paths of a Go file.
+func goFileImports(path string) ([]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	imports := make([]string, 0, len(file.Imports))
+	for _, spec := range file.Imports {
+		if importPath, err := strconv.Unquote(spec.Path.Value); err == nil {
+			imports = append(imports, importPath)
+		}
+	}
+	return imports, nil
+}
+
+// sortByDeps orders the Go files of selected after the selected files of the
+// packages they import. Anything else keeps its place as far as possible,
+// and import cycles are broken in the given order.
+func sortByDeps(dir string, selected []Selection) []Selection {
+	module, ok := findGoModule(dir)
+	if !ok {
+		return selected
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return selected
+	}
+
+	byDir := make(map[string][]int)
+	for i, sel := range selected {
+		if strings.HasSuffix(sel.Path, ".go") {
+			pkgDir := filepath.Dir(filepath.Join(abs, sel.Path))
+			byDir[pkgDir] = append(byDir[pkgDir], i)
+		}
+	}
+
+	deps := make([][]int, len(selected))
+	for i, sel := range selected {
+		if !strings.HasSuffix(sel.Path, ".go") {
+			continue
+		}
+		imports, err := goFileImports(filepath.Join(abs, sel.Path))
+		if err != nil {
+			continue
+		}
+		for _, importPath := range imports {
+			if pkgDir, ok := module.packageDir(importPath); ok {
+				deps[i] = append(deps[i], byDir[pkgDir]...)
+			}
+		}
+	}
+
+	done := make([]bool, len(selected))
+	sorted := make([]Selection, 0, len(selected))
+	for len(sorted) < len(selected) {
+		next := -1
+		for i := range selected {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for _, d := range deps[i] {
+				if !done[d] && d != i {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			// A cycle, take the first file that is left.
+			for i := range selected {
+				if !done[i] {
+					next = i
+					break
+				}
+			}
+		}
+		done[next] = true
+		sorted = append(sorted, selected[next])
+	}
+	return sorted
+}
+
+// goPackageFiles returns the Go files of the package in dir, with its tests
+// when tests is set.
+func goPackageFiles(dir string, tests bool) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || !tests && strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	return files
+}
+
+// goImporters maps the import paths of the packages of the module to the Go
+// files that import them, tests included. Nested modules, vendor, testdata
+// and hidden directories are skipped like the go tool does.
+func goImporters(module goModule) map[string][]string {
+	importers := make(map[string][]string)
+	filepath.WalkDir(module.Root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path == module.Root {
+				return nil
+			}
+			if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || FileExists(filepath.Join(path, "go.mod")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") {
+			return nil
+		}
+		imports, err := goFileImports(path)
+		if err != nil {
+			return nil
+		}
+		for _, importPath := range imports {
+			importers[importPath] = append(importers[importPath], path)
+		}
+		return nil
+	})
+	return importers
+}
+
+// goDeps follows the imports of the given Go files within their module and
+// returns the files of the packages they depend on, up to depth levels of
+// imports or all of them for 0. With reverse it returns the files that
+// depend on the packages of the given files instead. The files themselves
+// are left out, paths are absolute and in the order they were found.
+func goDeps(files []string, depth int, reverse bool) ([]string, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	var start []string
+	for _, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, err
+		}
+		start = append(start, abs)
+	}
+	module, ok := findGoModule(filepath.Dir(start[0]))
+	if !ok {
+		return nil, fmt.Errorf("no go.mod found for %s", files[0])
+	}
+
+	var importers map[string][]string
+	if reverse {
+		importers = goImporters(module)
+	}
+
+	seenFiles := make(map[string]bool)
+	for _, f := range start {
+		seenFiles[f] = true
+	}
+	seenPackages := make(map[string]bool)
+	var result []string
+	frontier := start
+	for level := 1; len(frontier) > 0 && (depth == 0 || level <= depth); level++ {
+		var found []string
+		for _, f := range frontier {
+			for _, dep := range goFileDeps(module, f, reverse, importers, seenPackages) {
+				if !seenFiles[dep] {
+					seenFiles[dep] = true
+					found = append(found, dep)
+				}
+			}
+		}
+		slices.Sort(found)
+		result = append(result, found...)
+		frontier = found
+	}
+	return result, nil
+}
+
+// goFileDeps returns the files of the packages file imports, or with reverse
+// the files importing the package of file. Packages in seen are skipped and
+// the new ones are added to it.
+func goFileDeps(module goModule, file string, reverse bool, importers map[string][]string, seen map[string]bool) []string {
+	if reverse {
+		// Tests can't be imported, their dependents end the search.
+		importPath, ok := module.importPath(filepath.Dir(file))
+		if !ok || strings.HasSuffix(file, "_test.go") || seen[importPath] {
+			return nil
+		}
+		seen[importPath] = true
+		return importers[importPath]
+	}
+
+	imports, err := goFileImports(file)
+	if err != nil {
+		return nil
+	}
+	var deps []string
+	for _, importPath := range imports {
+		pkgDir, ok := module.packageDir(importPath)
+		if !ok || seen[importPath] {
+			continue
+		}
+		seen[importPath] = true
+		deps = append(deps, goPackageFiles(pkgDir, false)...)
+	}
+	return deps
+}
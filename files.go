@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 )
 
 
@@ -15,13 +18,36 @@ type FileNode struct {
 	IsDir    bool
 	IsBinary bool
 	Size     int64
+	ModTime  time.Time
 	Children []*FileNode
 	Parent   *FileNode
 
+	Ignored  bool
+	// Unread marks an ignored directory whose contents are not read yet.
+	Unread   bool
+
 	Expanded     bool
 	Selected     bool
 	SomeSelected bool
 	Depth        int
+
+	// Ranges narrows a selected file down to some of its lines, nil means the
+	// whole file. Outline copies the outline of a selected file instead, and
+	// Symbols only the top-level declarations of a Go file with these names.
+	Ranges  []LineRange
+	Outline bool
+	Symbols []string
+
+	// Order and Priority are the place and priority a selected file has in
+	// the stored selection, zero when it was selected after the last save.
+	Order    int
+	Priority int
+
+	// Decls are the symbol nodes of an expanded Go file, loaded by
+	// loadSymbols. A symbol node shares the Path of its file, Symbol is the
+	// name of its declaration.
+	Decls  []*FileNode
+	Symbol string
 }
 
 func (n *FileNode) SetSelectParentFromChild(selected bool) {
@@ -36,7 +62,7 @@ func (n *FileNode) SetSelectParentFromChild(selected bool) {
 			for _, node := range n.Parent.Children {
 
 				emptyDir := node.IsDir && len(node.Children) == 0
-				if node.IsBinary || emptyDir {
+				if node.IsBinary || node.Ignored || emptyDir {
 					continue
 				}
 				if node.Selected == false {
@@ -58,7 +84,7 @@ func (n *FileNode) SetSelectParentFromChild(selected bool) {
 			allNotSelected := true
 			for _, node := range n.Parent.Children {
 				emptyDir := node.IsDir && len(node.Children) == 0
-				if node.IsBinary || emptyDir {
+				if node.IsBinary || node.Ignored || emptyDir {
 					continue
 				}
 				if node.Selected == true {
@@ -81,22 +107,114 @@ func (n *FileNode) SetSelectParentFromChild(selected bool) {
 
 func (n *FileNode) SetSelected(selected bool) {
 	emptyDir := n.IsDir && len(n.Children) == 0
-	if n.IsBinary || emptyDir {
+	if n.IsBinary || n.Ignored || emptyDir {
 		return
 	}
 	n.Selected = selected
+	if !selected {
+		n.Ranges = nil
+		n.Outline = false
+		n.Symbols = nil
+		n.Order = 0
+		n.Priority = 0
+	}
 	for _, child := range n.Children {
 		child.SetSelected(selected)
 	}
 	n.SetSelectParentFromChild(selected)
 }
 
+// fileState is how much of a selected file goes into the context.
+type fileState struct {
+	Ranges  []LineRange
+	Outline bool
+	Symbols []string
+}
+
+func (n *FileNode) state() fileState {
+	return fileState{Ranges: n.Ranges, Outline: n.Outline, Symbols: n.Symbols}
+}
+
+func (n *FileNode) setState(state fileState) {
+	n.Ranges = state.Ranges
+	n.Outline = state.Outline
+	n.Symbols = state.Symbols
+}
+
+// collectRanges remembers the line ranges, outlines and symbols of every
+// partially selected file below n, so an action that deselects them can be
+// undone.
+func collectRanges(n *FileNode) map[*FileNode]fileState {
+	states := make(map[*FileNode]fileState)
+	var traverse func(n *FileNode)
+	traverse = func(n *FileNode) {
+		if len(n.Ranges) > 0 || n.Outline || len(n.Symbols) > 0 {
+			states[n] = n.state()
+		}
+		for _, child := range n.Children {
+			traverse(child)
+		}
+	}
+	traverse(n)
+	return states
+}
+
+func restoreRanges(states map[*FileNode]fileState) {
+	for node, state := range states {
+		node.setState(state)
+	}
+}
+
 func (n *FileNode) ToggleExpand() {
 	if n.IsDir {
 		n.Expanded = !n.Expanded
 	}
 }
 
+// hasSymbols reports whether n is a Go file that expands into its symbols.
+func (n *FileNode) hasSymbols() bool {
+	return !n.IsDir && !n.IsBinary && !n.Ignored && n.Symbol == "" && strings.HasSuffix(n.Name, ".go")
+}
+
+// loadSymbols reads the top-level declarations of the Go file n into its
+// symbol nodes.
+func (n *FileNode) loadSymbols() error {
+	content, err := os.ReadFile(n.Path)
+	if err != nil {
+		return err
+	}
+	symbols, err := goSymbols(content)
+	if err != nil {
+		return err
+	}
+	n.Decls = nil
+	for _, sym := range symbols {
+		n.Decls = append(n.Decls, &FileNode{
+			Name:    sym.Label,
+			Path:    n.Path,
+			Size:    int64(len(sym.Text)),
+			ModTime: n.ModTime,
+			Parent:  n,
+			Depth:   n.Depth + 1,
+			Symbol:  sym.Name,
+		})
+	}
+	return nil
+}
+
+// symbolSelected reports whether the declaration of the symbol node n goes
+// into the context: its file is selected as a whole or with the symbol.
+func (n *FileNode) symbolSelected() bool {
+	file := n.Parent
+	if !file.Selected {
+		return false
+	}
+	if len(file.Symbols) > 0 {
+		return slices.Contains(file.Symbols, n.Symbol)
+	}
+	return len(file.Ranges) == 0 && !file.Outline
+}
+
 func buildFileTree(rootPath string) (*FileNode, error) {
 	root := &FileNode{
 		Name:     rootPath,
@@ -106,15 +224,25 @@ func buildFileTree(rootPath string) (*FileNode, error) {
 		Depth:    0,
 	}
 
-	err := filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+	err := readTree(root, rootPath, NewIgnoreMatcher(rootPath))
+	return root, err
+}
+
+// readTree reads the entries below the directory node dir into the tree.
+// Ignored directories are added without their contents, which are only read
+// by loadIgnored, and ignored files are not sniffed for binary content.
+func readTree(dir *FileNode, rootPath string, ignore *IgnoreMatcher) error {
+	nodes := map[string]*FileNode{dir.Path: dir}
+
+	return filepath.WalkDir(dir.Path, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return nil
 		}
-		if path == rootPath {
+		if path == dir.Path {
 			return nil
 		}
 
-		if strings.Contains(path, ".git") || strings.Contains(path, ".punjado") || strings.Contains(path, "node_modules") {
+		if isStateFile(d.Name()) {
 			if d.IsDir() {
 				return filepath.SkipDir
 			}
@@ -122,15 +250,22 @@ func buildFileTree(rootPath string) (*FileNode, error) {
 		}
 
 		parentDir := filepath.Dir(path)
-		parent := findNode(root, parentDir)
+		parent := nodes[parentDir]
 
 		if parent != nil {
+			ignored := parent.Ignored
+			if !ignored {
+				rel, _ := filepath.Rel(rootPath, path)
+				ignored = ignore.Match(rel, d.IsDir())
+			}
 			info, _ := d.Info()
 			var size int64
+			var modTime time.Time
 			var isBin bool
 			if info != nil {
 				size = info.Size()
-				if !d.IsDir() {
+				modTime = info.ModTime()
+				if !d.IsDir() && !ignored {
 					isBin = isBinaryFile(path)
 				}
 			}
@@ -138,18 +273,49 @@ func buildFileTree(rootPath string) (*FileNode, error) {
 				Name:     d.Name(),
 				Path:     path,
 				Size:     size,
+				ModTime:  modTime,
 				IsBinary: isBin,
 				IsDir:    d.IsDir(),
+				Ignored:  ignored,
 				Parent:   parent,
 				Depth:    parent.Depth + 1,
-				Expanded: true,
+				Expanded: d.IsDir() && !ignored,
 			}
 			parent.Children = append(parent.Children, node)
+			if node.IsDir {
+				if ignored && !dir.Ignored {
+					node.Unread = true
+					return filepath.SkipDir
+				}
+				nodes[path] = node
+			}
 		}
 		return nil
 	})
+}
 
-	return root, err
+// loadIgnored reads the contents of the ignored directories below root that
+// buildFileTree left out, for when ignored files are shown.
+func loadIgnored(root *FileNode) {
+	ignore := NewIgnoreMatcher(root.Path)
+	var traverse func(n *FileNode)
+	traverse = func(n *FileNode) {
+		if n.Unread {
+			n.Unread = false
+			readTree(n, root.Path, ignore)
+			return
+		}
+		for _, child := range n.Children {
+			traverse(child)
+		}
+	}
+	traverse(root)
+}
+
+// isStateFile reports whether name is the .git directory or one of the files
+// punjado itself keeps in the project, which never show up in the tree.
+func isStateFile(name string) bool {
+	return name == ".git" || name == ".punjado" || strings.HasPrefix(name, ".punjado.")
 }
 
 func findNode(root *FileNode, path string) *FileNode {
@@ -165,16 +331,38 @@ func findNode(root *FileNode, path string) *FileNode {
 	return nil
 }
 
-func flattenVisible(root *FileNode) []*FileNode {
+// flattenSelected lists the selected and partly selected nodes in tree
+// order, whether their directories are expanded or not.
+func flattenSelected(root *FileNode) []*FileNode {
+	var result []*FileNode
+	var traverse func(n *FileNode)
+	traverse = func(n *FileNode) {
+		for _, child := range n.Children {
+			if child.Selected || child.SomeSelected {
+				result = append(result, child)
+				traverse(child)
+			}
+		}
+	}
+	traverse(root)
+	return result
+}
+
+func flattenVisible(root *FileNode, showIgnored bool) []*FileNode {
 	var result []*FileNode
 
 	var traverse func(n *FileNode)
 	traverse = func(n *FileNode) {
+		if n.Ignored && !showIgnored {
+			return
+		}
 		result = append(result, n)
 		if n.IsDir && n.Expanded {
 			for _, child := range n.Children {
 				traverse(child)
 			}
+		} else if n.Expanded {
+			result = append(result, n.Decls...)
 		}
 	}
 
@@ -193,14 +381,18 @@ func flattenVisible(root *FileNode) []*FileNode {
 }
 // TODO: maybe move into utils?
 
-func saveState(root *FileNode, rootPath string) {
-	var selectedPaths []string
+// collectSelection returns the selected files below root in tree order.
+func collectSelection(root *FileNode, rootPath string) []Selection {
+	var selected []Selection
 	var traverse func(n *FileNode)
 	traverse = func(n *FileNode) {
 		if n.Selected && !n.IsDir {
 			rel, err := filepath.Rel(rootPath, n.Path)
 			if err == nil {
-				selectedPaths = append(selectedPaths, rel)
+				selected = append(selected, Selection{
+					Path: rel, Ranges: n.Ranges, Outline: n.Outline, Symbols: n.Symbols,
+					Order: n.Order, Priority: n.Priority,
+				})
 			}
 		}
 		for _, child := range n.Children {
@@ -208,9 +400,22 @@ func saveState(root *FileNode, rootPath string) {
 		}
 	}
 	traverse(root)
+	return selected
+}
+
+// saveState writes the selection of the tree to .punjado, unless it is
+// stored already, and returns it.
+func saveState(root *FileNode, rootPath string) map[string]Selection {
 	saveFile := filepath.Join(rootPath, ".punjado")
-	content := strings.Join(selectedPaths, "\n")
-	os.WriteFile(saveFile, []byte(content), 0644)
+	data, _ := os.ReadFile(saveFile)
+	// Files keep the place they have in the stored selection, new ones are
+	// added at the end.
+	selected := keepOrder(parseSelectionFile(data), collectSelection(root, rootPath))
+	content := formatSelectionFile(parseSelectionSettings(data), selectionList(selected))
+	if !bytes.Equal(content, data) {
+		os.WriteFile(saveFile, content, 0644)
+	}
+	return selected
 }
 
 func loadState(root *FileNode, rootPath string) {
@@ -219,18 +424,38 @@ func loadState(root *FileNode, rootPath string) {
 	if err != nil {
 		return
 	}
-	selectedMap := make(map[string]bool)
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		if strings.TrimSpace(line) != "" {
-			selectedMap[line] = true
+	applySelection(root, rootPath, parseSelectionFile(data))
+}
+
+// applySelection replaces the selection of the whole tree with selectedMap.
+func applySelection(root *FileNode, rootPath string, selectedMap map[string]Selection) {
+	var clear func(n *FileNode)
+	clear = func(n *FileNode) {
+		n.Selected = false
+		n.SomeSelected = false
+		n.Ranges = nil
+		n.Outline = false
+		n.Symbols = nil
+		n.Order = 0
+		n.Priority = 0
+		for _, child := range n.Children {
+			clear(child)
 		}
 	}
+	clear(root)
+
 	var traverse func(n *FileNode)
 	traverse = func(n *FileNode) {
 		rel, _ := filepath.Rel(rootPath, n.Path)
-		if selectedMap[rel] {
+		if sel, ok := selectedMap[rel]; ok {
 			n.SetSelected(true)
+			if !n.IsDir && n.Selected {
+				n.Ranges = sel.Ranges
+				n.Outline = sel.Outline
+				n.Symbols = sel.Symbols
+				n.Order = sel.Order
+				n.Priority = sel.Priority
+			}
 		}
 		for _, child := range n.Children {
 			traverse(child)
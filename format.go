@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// A formatFunc renders the selected files into the text that is copied,
+// after the commit messages and the project tree when there are any.
+type formatFunc func(commits string, tree string, files []contextFile) string
+
+// outputFormats are the formats punjado copy --format and the output.format
+// setting accept.
+var outputFormats = map[string]formatFunc{
+	"plain":    formatPlain,
+	"xml":      formatXML,
+	"markdown": formatMarkdown,
+	"json":     formatJSON,
+	"jsonl":    formatJSONL,
+}
+
+func formatPlain(commits string, tree string, files []contextFile) string {
+	var sb strings.Builder
+	if commits != "" {
+		sb.WriteString("--- COMMITS ---\n")
+		sb.WriteString(ensureNewline(commits))
+	}
+	if tree != "" {
+		sb.WriteString("--- TREE ---\n")
+		sb.WriteString(tree)
+	}
+	for _, f := range files {
+		if f.Diff {
+			sb.WriteString(fmt.Sprintf("\n--- DIFF: %s ---\n", f.Path))
+		} else if f.Outline {
+			sb.WriteString(fmt.Sprintf("\n--- FILE: %s (outline) ---\n", f.Path))
+		} else if len(f.Symbols) > 0 {
+			sb.WriteString(fmt.Sprintf("\n--- FILE: %s (symbols %s) ---\n", f.Path, strings.Join(f.Symbols, ", ")))
+		} else if len(f.Ranges) > 0 {
+			sb.WriteString(fmt.Sprintf("\n--- FILE: %s (lines %s) ---\n", f.Path, formatRanges(f.Ranges)))
+		} else {
+			sb.WriteString(fmt.Sprintf("\n--- FILE: %s ---\n", f.Path))
+		}
+		switch {
+		case f.Err != nil:
+			sb.WriteString(fmt.Sprintf("(Error reading file: %v)\n", f.Err))
+		case len(f.Ranges) > 0:
+			for i, r := range f.Ranges {
+				sb.WriteString(fmt.Sprintf("--- LINES %d-%d ---\n", r.Start, r.End))
+				sb.WriteString(f.Chunks[i])
+			}
+		default:
+			sb.WriteString(f.Content())
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// formatXML wraps every file in the <document> tags Anthropic recommends
+// for long context. The content is not escaped, models read it as is.
+func formatXML(commits string, tree string, files []contextFile) string {
+	var sb strings.Builder
+	if commits != "" {
+		sb.WriteString("<commits>\n" + ensureNewline(commits) + "</commits>\n")
+	}
+	if tree != "" {
+		sb.WriteString("<directory_tree>\n" + tree + "</directory_tree>\n")
+	}
+	sb.WriteString("<documents>\n")
+	for i, f := range files {
+		source := f.Path
+		if len(f.Ranges) > 0 {
+			source += ":" + formatRanges(f.Ranges)
+		}
+		if f.Diff {
+			source += " (diff)"
+		}
+		if f.Outline {
+			source += " (outline)"
+		}
+		if len(f.Symbols) > 0 {
+			source += " (symbols " + strings.Join(f.Symbols, ", ") + ")"
+		}
+		sb.WriteString(fmt.Sprintf("<document index=\"%d\">\n", i+1))
+		sb.WriteString("<source>" + source + "</source>\n")
+		sb.WriteString("<document_content>\n")
+		if f.Err != nil {
+			sb.WriteString(fmt.Sprintf("(Error reading file: %v)\n", f.Err))
+		} else {
+			sb.WriteString(ensureNewline(strings.Join(f.Chunks, "...\n")))
+		}
+		sb.WriteString("</document_content>\n")
+		sb.WriteString("</document>\n")
+	}
+	sb.WriteString("</documents>\n")
+	return sb.String()
+}
+
+// formatMarkdown puts every file under a heading in a code fence tagged
+// with its language, one fence per line range.
+func formatMarkdown(commits string, tree string, files []contextFile) string {
+	var sb strings.Builder
+	if commits != "" {
+		commits = ensureNewline(commits)
+		sb.WriteString("## Commits\n\n" + markdownFence(commits) + "\n" + commits + markdownFence(commits) + "\n")
+	}
+	if tree != "" {
+		if commits != "" {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("## Project tree\n\n" + markdownFence(tree) + "\n" + tree + markdownFence(tree) + "\n")
+	}
+	for i, f := range files {
+		if i > 0 || tree != "" || commits != "" {
+			sb.WriteString("\n")
+		}
+		if f.Diff {
+			sb.WriteString(fmt.Sprintf("## %s (diff)\n\n", f.Path))
+		} else if f.Outline {
+			sb.WriteString(fmt.Sprintf("## %s (outline)\n\n", f.Path))
+		} else if len(f.Symbols) > 0 {
+			sb.WriteString(fmt.Sprintf("## %s (symbols %s)\n\n", f.Path, strings.Join(f.Symbols, ", ")))
+		} else if len(f.Ranges) > 0 {
+			sb.WriteString(fmt.Sprintf("## %s (lines %s)\n\n", f.Path, formatRanges(f.Ranges)))
+		} else {
+			sb.WriteString(fmt.Sprintf("## %s\n\n", f.Path))
+		}
+		if f.Err != nil {
+			sb.WriteString(fmt.Sprintf("(Error reading file: %v)\n", f.Err))
+			continue
+		}
+		for j, chunk := range f.Chunks {
+			if j > 0 {
+				sb.WriteString("\n")
+			}
+			fence := markdownFence(chunk)
+			sb.WriteString(fence + f.Language + "\n")
+			sb.WriteString(ensureNewline(chunk))
+			sb.WriteString(fence + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// markdownFence returns a fence longer than any run of backticks in text,
+// so files that contain fences themselves stay intact.
+func markdownFence(text string) string {
+	longest, run := 0, 0
+	for _, c := range text {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+type jsonContextFile struct {
+	Path     string   `json:"path"`
+	Language string   `json:"language,omitempty"`
+	Ranges   string   `json:"ranges,omitempty"`
+	Diff     bool     `json:"diff,omitempty"`
+	Outline  bool     `json:"outline,omitempty"`
+	Symbols  []string `json:"symbols,omitempty"`
+	Content  string   `json:"content"`
+	Error    string   `json:"error,omitempty"`
+}
+
+func toJSONContextFile(f contextFile) jsonContextFile {
+	out := jsonContextFile{Path: f.Path, Language: f.Language, Diff: f.Diff, Outline: f.Outline, Symbols: f.Symbols, Content: f.Content()}
+	if len(f.Ranges) > 0 {
+		out.Ranges = formatRanges(f.Ranges)
+	}
+	if f.Err != nil {
+		out.Error = f.Err.Error()
+	}
+	return out
+}
+
+// formatJSON writes an array of files, or an object with the commits, the
+// tree and the files when there are commits or a tree.
+func formatJSON(commits string, tree string, files []contextFile) string {
+	out := make([]jsonContextFile, len(files))
+	for i, f := range files {
+		out[i] = toJSONContextFile(f)
+	}
+	var data []byte
+	if commits != "" || tree != "" {
+		data, _ = json.MarshalIndent(struct {
+			Commits string            `json:"commits,omitempty"`
+			Tree    string            `json:"tree,omitempty"`
+			Files   []jsonContextFile `json:"files"`
+		}{commits, tree, out}, "", "  ")
+	} else {
+		data, _ = json.MarshalIndent(out, "", "  ")
+	}
+	return string(data) + "\n"
+}
+
+// formatJSONL writes one JSON object per file and line, after one with the
+// commits and one with the tree when there are any.
+func formatJSONL(commits string, tree string, files []contextFile) string {
+	var sb strings.Builder
+	if commits != "" {
+		data, _ := json.Marshal(struct {
+			Commits string `json:"commits"`
+		}{commits})
+		sb.Write(data)
+		sb.WriteString("\n")
+	}
+	if tree != "" {
+		data, _ := json.Marshal(struct {
+			Tree string `json:"tree"`
+		}{tree})
+		sb.Write(data)
+		sb.WriteString("\n")
+	}
+	for _, f := range files {
+		data, _ := json.Marshal(toJSONContextFile(f))
+		sb.Write(data)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func ensureNewline(s string) string {
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		return s + "\n"
+	}
+	return s
+}
+
+// languages maps file extensions to the names code fences use.
+var languages = map[string]string{
+	".go":     "go",
+	".mod":    "go",
+	".py":     "python",
+	".js":     "javascript",
+	".mjs":    "javascript",
+	".cjs":    "javascript",
+	".jsx":    "jsx",
+	".ts":     "typescript",
+	".tsx":    "tsx",
+	".rs":     "rust",
+	".c":      "c",
+	".h":      "c",
+	".cc":     "cpp",
+	".cpp":    "cpp",
+	".hpp":    "cpp",
+	".cs":     "csharp",
+	".java":   "java",
+	".kt":     "kotlin",
+	".swift":  "swift",
+	".rb":     "ruby",
+	".php":    "php",
+	".lua":    "lua",
+	".sh":     "bash",
+	".bash":   "bash",
+	".zsh":    "zsh",
+	".fish":   "fish",
+	".ps1":    "powershell",
+	".sql":    "sql",
+	".html":   "html",
+	".htm":    "html",
+	".css":    "css",
+	".scss":   "scss",
+	".vue":    "vue",
+	".svelte": "svelte",
+	".json":   "json",
+	".yaml":   "yaml",
+	".yml":    "yaml",
+	".toml":   "toml",
+	".xml":    "xml",
+	".md":     "markdown",
+	".proto":  "protobuf",
+	".tf":     "hcl",
+	".zig":    "zig",
+	".ex":     "elixir",
+	".exs":    "elixir",
+	".erl":    "erlang",
+	".hs":     "haskell",
+	".ml":     "ocaml",
+	".scala":  "scala",
+	".dart":   "dart",
+	".r":      "r",
+}
+
+// languageForPath guesses the language of a file from its name, or returns
+// "" when it is unknown.
+func languageForPath(path string) string {
+	switch strings.ToLower(filepath.Base(path)) {
+	case "makefile", "gnumakefile":
+		return "makefile"
+	case "dockerfile":
+		return "dockerfile"
+	case "go.sum":
+		return ""
+	}
+	return languages[strings.ToLower(filepath.Ext(path))]
+}
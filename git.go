@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// runGit runs git in dir and returns its output without the trailing newline.
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	output, err := cmd.Output()
+	return strings.TrimRight(string(output), "\n"), err
+}
+
+// gitHead returns the current branch and the short hash of HEAD, both empty
+// outside of a repository.
+func gitHead(dir string) (branch string, commit string) {
+	branch, _ = runGit(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	commit, _ = runGit(dir, "rev-parse", "--short", "HEAD")
+	return branch, commit
+}
+
+// gitStatusEntry is a changed file as git status reports it. XY holds the
+// status in the index and in the working tree, "??" for untracked files.
+// From is the path a renamed file had before, if it was below dir too.
+type gitStatusEntry struct {
+	XY   string
+	Path string
+	From string
+}
+
+func (e gitStatusEntry) Untracked() bool {
+	return e.XY == "??"
+}
+
+func (e gitStatusEntry) Staged() bool {
+	return !e.Untracked() && e.XY[0] != '.'
+}
+
+func (e gitStatusEntry) Unstaged() bool {
+	return !e.Untracked() && e.XY[1] != '.'
+}
+
+// gitStatus lists the changed files below dir, with paths relative to dir.
+// It reads git status --porcelain=v2 -z, whose paths are relative to the
+// root of the repository and never quoted.
+func gitStatus(dir string) ([]gitStatusEntry, error) {
+	prefix, err := runGit(dir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not in a git repository", dir)
+	}
+	output, err := runGit(dir, "status", "--porcelain=v2", "-z", "--untracked-files=all", "--", ".")
+	if err != nil {
+		return nil, fmt.Errorf("git status failed in '%s'", dir)
+	}
+	return parseGitStatus(output, prefix), nil
+}
+
+// parseGitStatus reads the output of git status --porcelain=v2 -z. Paths
+// are made relative to prefix, the directory below the root of the
+// repository, and entries outside of it are left out.
+func parseGitStatus(output string, prefix string) []gitStatusEntry {
+	var entries []gitStatusEntry
+	fields := strings.Split(output, "\x00")
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if len(field) < 2 {
+			continue
+		}
+		var entry gitStatusEntry
+		switch field[0] {
+		case '1':
+			parts := strings.SplitN(field, " ", 9)
+			if len(parts) < 9 {
+				continue
+			}
+			entry = gitStatusEntry{XY: parts[1], Path: parts[8]}
+		case '2':
+			// Renames and copies are followed by the original path.
+			parts := strings.SplitN(field, " ", 10)
+			if len(parts) < 10 || i+1 >= len(fields) {
+				continue
+			}
+			i++
+			entry = gitStatusEntry{XY: parts[1], Path: parts[9], From: fields[i]}
+		case 'u':
+			parts := strings.SplitN(field, " ", 11)
+			if len(parts) < 11 {
+				continue
+			}
+			entry = gitStatusEntry{XY: parts[1], Path: parts[10]}
+		case '?':
+			entry = gitStatusEntry{XY: "??", Path: field[2:]}
+		default:
+			continue
+		}
+
+		rel, found := strings.CutPrefix(entry.Path, prefix)
+		if !found {
+			continue
+		}
+		entry.Path = rel
+		entry.From, found = strings.CutPrefix(entry.From, prefix)
+		if !found {
+			entry.From = ""
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// gitFileStatuses maps the changed files below dir, relative to dir, to
+// modified, added, deleted, renamed, untracked or conflict.
+func gitFileStatuses(dir string) map[string]string {
+	statuses := make(map[string]string)
+	entries, _ := gitStatus(dir)
+	for _, entry := range entries {
+		statuses[entry.Path] = gitStatusWord(entry.XY)
+	}
+	return statuses
+}
+
+func gitStatusWord(code string) string {
+	switch {
+	case code == "??":
+		return "untracked"
+	case code[0] == 'U' || code[1] == 'U' || code == "AA" || code == "DD":
+		return "conflict"
+	case code[0] == 'R':
+		return "renamed"
+	case code[0] == 'A':
+		return "added"
+	case code[0] == 'D' || code[1] == 'D':
+		return "deleted"
+	}
+	return "modified"
+}
+
+// gitDiff is what punjado git diff compares: the working tree or, with
+// Staged, the index against HEAD, a revision range or the merge base of
+// HEAD and Base.
+type gitDiff struct {
+	Staged bool
+	Range  string
+	Base   string
+}
+
+// args returns the git diff command line, with paths relative to dir.
+func (d gitDiff) args(dir string) ([]string, error) {
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--relative"}
+	if d.Staged {
+		args = append(args, "--staged")
+	}
+	switch {
+	case d.Base != "" && d.Range != "":
+		return nil, fmt.Errorf("--base can't be combined with a revision range")
+	case d.Staged && d.Range != "":
+		return nil, fmt.Errorf("--staged can't be combined with a revision range")
+	case d.Staged && d.Base != "":
+		return nil, fmt.Errorf("--staged can't be combined with --base")
+	case d.Base != "":
+		mergeBase, err := runGit(dir, "merge-base", d.Base, "HEAD")
+		if err != nil {
+			return nil, fmt.Errorf("no merge base of '%s' and HEAD", d.Base)
+		}
+		args = append(args, mergeBase)
+	case d.Range != "":
+		args = append(args, d.Range)
+	}
+	return args, nil
+}
+
+// contentRev is the revision that holds the files after the change, ":" for
+// the index and "" for the working tree.
+func (d gitDiff) contentRev() string {
+	if d.Staged {
+		return ":"
+	}
+	for _, sep := range []string{"...", ".."} {
+		if _, to, found := strings.Cut(d.Range, sep); found {
+			if to == "" {
+				return "HEAD"
+			}
+			return to
+		}
+	}
+	return ""
+}
+
+// gitDiffFiles returns the unified diff of every file the diff touches and,
+// with full, the content of the file after the change behind it. changed
+// lists the paths of the files, relative to dir. The state files of
+// punjado are left out.
+func gitDiffFiles(dir string, d gitDiff, full bool) (files []contextFile, changed []string, err error) {
+	args, err := d.args(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	changes, err := gitChanges(dir, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rev := d.contentRev()
+	for _, change := range changes {
+		path, paths := change.Path, []string{change.Path}
+		if isStateFile(filepath.Base(path)) {
+			continue
+		}
+		if change.From != "" {
+			paths = append(paths, change.From)
+		}
+
+		file := contextFile{Path: path, Language: "diff", Diff: true}
+		diff, err := runGit(dir, append(append(slices.Clone(args), "--"), paths...)...)
+		if err != nil {
+			file.Err = err
+		} else {
+			file.Chunks = []string{ensureNewline(diff)}
+		}
+		files = append(files, file)
+		changed = append(changed, path)
+
+		if !full || change.Status == 'D' {
+			continue
+		}
+		content, err := gitFileContent(dir, rev, path)
+		if bytes.IndexByte(content[:min(len(content), 512)], 0) != -1 {
+			continue
+		}
+		file = contextFile{Path: path, Language: languageForPath(path), Err: err}
+		if err == nil {
+			file.Chunks = []string{string(content)}
+		}
+		files = append(files, file)
+	}
+	return files, changed, nil
+}
+
+// gitChange is a file changed by a diff. From is the path a renamed or
+// copied file had before.
+type gitChange struct {
+	Status byte
+	Path   string
+	From   string
+}
+
+// gitChanges lists the files changed by the git diff command args, as
+// returned by gitDiff.args.
+func gitChanges(dir string, args []string) ([]gitChange, error) {
+	output, err := runGit(dir, append(slices.Clone(args), "--name-status", "-z")...)
+	if err != nil {
+		return nil, fmt.Errorf("git diff failed, is '%s' in a git repository?", dir)
+	}
+	return parseGitChanges(output), nil
+}
+
+// parseGitChanges reads the output of git diff --name-status -z.
+func parseGitChanges(output string) []gitChange {
+	var changes []gitChange
+	fields := strings.Split(output, "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i] == "" {
+			continue
+		}
+		change := gitChange{Status: fields[i][0], Path: fields[i+1]}
+		// Renames and copies are followed by the new path.
+		if (change.Status == 'R' || change.Status == 'C') && i+2 < len(fields) {
+			change.From, change.Path = change.Path, fields[i+2]
+			i++
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// gitFileContent reads path, relative to dir, as it is in rev, in the index
+// for ":" or in the working tree for "".
+func gitFileContent(dir string, rev string, path string) ([]byte, error) {
+	if rev == "" {
+		return os.ReadFile(filepath.Join(dir, path))
+	}
+	if rev != ":" {
+		rev += ":"
+	}
+	cmd := exec.Command("git", "-C", dir, "show", rev+"./"+filepath.ToSlash(path))
+	return cmd.Output()
+}
+
+// commitsSetting names the revision range whose commit messages go in front
+// of the copied context, set by punjado git commits and branch --messages.
+const commitsSetting = "commits"
+
+// commitMessages returns the log of the commits of the commits setting of
+// the project in dir, oldest first, or "" when it is not set.
+func commitMessages(dir string) string {
+	revs := readSettings(dir)[commitsSetting]
+	if revs == "" {
+		return ""
+	}
+	output, err := runGit(dir, "log", "--reverse", "--format=%x1e%h %s%n%w(0,4,4)%b", revs)
+	if err != nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, commit := range strings.Split(output, "\x1e")[1:] {
+		for _, line := range strings.Split(strings.TrimSpace(commit), "\n") {
+			sb.WriteString(strings.TrimRight(line, " ") + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// commitRange turns a revision into the range git log and git diff take:
+// a single commit stands for the changes it made.
+func commitRange(rev string) string {
+	if strings.Contains(rev, "..") || strings.HasSuffix(rev, "^!") {
+		return rev
+	}
+	return rev + "^!"
+}
+
+// emptyTree is the id of the tree without any files.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// commitDiffRange is the range git diff takes for revs. A root commit has no
+// parent and git diff would compare it to the working tree, so its changes
+// are taken from the empty tree instead.
+func commitDiffRange(dir string, revs string) string {
+	rev, found := strings.CutSuffix(revs, "^!")
+	if !found {
+		return revs
+	}
+	if _, err := runGit(dir, "rev-parse", "--verify", "--quiet", rev+"^{commit}"); err != nil {
+		return revs
+	}
+	if _, err := runGit(dir, "rev-parse", "--verify", "--quiet", rev+"^"); err != nil {
+		return emptyTree + ".." + rev
+	}
+	return revs
+}
+
+// branchBase returns base, or main or master when base is empty, if it
+// names a revision.
+func branchBase(dir string, base string) (string, error) {
+	candidates := []string{base}
+	if base == "" {
+		candidates = []string{"main", "master"}
+	}
+	for _, rev := range candidates {
+		if _, err := runGit(dir, "rev-parse", "--verify", "--quiet", rev+"^{commit}"); err == nil {
+			return rev, nil
+		}
+	}
+	if base == "" {
+		return "", fmt.Errorf("no main or master branch, pass --base")
+	}
+	return "", fmt.Errorf("unknown revision '%s'", base)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// git runs git in dir with a fixed author and fails the test on an error.
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// writeFiles writes files below dir, creating their directories.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGitDiffArgs(t *testing.T) {
+	common := []string{"diff", "--no-color", "--no-ext-diff", "--relative"}
+	tests := []struct {
+		name    string
+		diff    gitDiff
+		want    []string
+		wantErr bool
+	}{
+		{name: "working tree", diff: gitDiff{}, want: common},
+		{name: "staged", diff: gitDiff{Staged: true}, want: append(common[:4:4], "--staged")},
+		{name: "range", diff: gitDiff{Range: "main..HEAD"}, want: append(common[:4:4], "main..HEAD")},
+		{name: "base and range", diff: gitDiff{Base: "main", Range: "a..b"}, wantErr: true},
+		{name: "staged and range", diff: gitDiff{Staged: true, Range: "a..b"}, wantErr: true},
+		{name: "staged and base", diff: gitDiff{Staged: true, Base: "main"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.diff.args(t.TempDir())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("args = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommitDiffRange(t *testing.T) {
+	dir := newIgnoreRepo(t, map[string]string{"a.txt": "a\n"})
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-q", "-m", "one")
+	root := git(t, dir, "rev-parse", "HEAD")
+	writeFiles(t, dir, map[string]string{"b.txt": "b\n"})
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-q", "-m", "two")
+
+	tests := []struct {
+		revs string
+		want string
+	}{
+		{"HEAD^!", "HEAD^!"},
+		{root + "^!", emptyTree + ".." + root},
+		{"HEAD~1^!", emptyTree + "..HEAD~1"},
+		{"HEAD~1..HEAD", "HEAD~1..HEAD"},
+		{"nosuch^!", "nosuch^!"},
+	}
+	for _, tt := range tests {
+		if got := commitDiffRange(dir, tt.revs); got != tt.want {
+			t.Errorf("commitDiffRange(%q) = %q, want %q", tt.revs, got, tt.want)
+		}
+	}
+
+	changes, err := gitChanges(dir, []string{"diff", "--relative", commitDiffRange(dir, commitRange(root))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Path != "a.txt" {
+		t.Errorf("changes of the root commit = %+v, want a.txt", changes)
+	}
+}
+
+func TestParseGitStatus(t *testing.T) {
+	const hash = "587be6b4c3f93f93c489c0111bba5596147a26cb"
+	ordinary := func(xy, path string) string {
+		return "1 " + xy + " N... 100644 100644 100644 " + hash + " " + hash + " " + path
+	}
+	renamed := func(xy, path, from string) string {
+		return "2 " + xy + " N... 100644 100644 100644 " + hash + " " + hash + " R100 " + path + "\x00" + from
+	}
+	unmerged := func(xy, path string) string {
+		return "u " + xy + " N... 100644 100644 100644 100644 " + hash + " " + hash + " " + hash + " " + path
+	}
+	status := func(fields ...string) string {
+		return strings.Join(fields, "\x00") + "\x00"
+	}
+
+	tests := []struct {
+		name   string
+		output string
+		prefix string
+		want   []gitStatusEntry
+	}{
+		{name: "clean", output: "", want: nil},
+		{
+			name:   "ordinary and untracked",
+			output: status(ordinary(".M", "a.go"), ordinary("A.", "dir/b c.go"), "? new.txt"),
+			want: []gitStatusEntry{
+				{XY: ".M", Path: "a.go"},
+				{XY: "A.", Path: "dir/b c.go"},
+				{XY: "??", Path: "new.txt"},
+			},
+		},
+		{
+			name:   "rename is followed by the original path",
+			output: status(renamed("R.", "new.go", "old.go"), ordinary(".D", "gone.go")),
+			want: []gitStatusEntry{
+				{XY: "R.", Path: "new.go", From: "old.go"},
+				{XY: ".D", Path: "gone.go"},
+			},
+		},
+		{
+			name:   "unmerged",
+			output: status(unmerged("UU", "both.go"), unmerged("AA", "added.go"), unmerged("DU", "deleted.go")),
+			want: []gitStatusEntry{
+				{XY: "UU", Path: "both.go"},
+				{XY: "AA", Path: "added.go"},
+				{XY: "DU", Path: "deleted.go"},
+			},
+		},
+		{
+			name:   "paths relative to the prefix",
+			output: status(ordinary(".M", "sub/a.go"), ordinary(".M", "top.go"), renamed("R.", "sub/moved.go", "top.txt"), renamed("R.", "sub/y.go", "sub/x.go"), "? sub/deep/n.txt"),
+			prefix: "sub/",
+			want: []gitStatusEntry{
+				{XY: ".M", Path: "a.go"},
+				{XY: "R.", Path: "moved.go"},
+				{XY: "R.", Path: "y.go", From: "x.go"},
+				{XY: "??", Path: "deep/n.txt"},
+			},
+		},
+		{
+			name:   "ignored and malformed entries are skipped",
+			output: status("! build/out", "1 .M short", ordinary(".M", "a.go")),
+			want:   []gitStatusEntry{{XY: ".M", Path: "a.go"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseGitStatus(tt.output, tt.prefix); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseGitStatus = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitStatus(t *testing.T) {
+	dir := newIgnoreRepo(t, map[string]string{
+		"top.txt":     "top\n",
+		"sub/old.txt": "old\n",
+		"sub/mod.txt": "mod\n",
+	})
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-q", "-m", "one")
+	git(t, dir, "mv", "sub/old.txt", "sub/new.txt")
+	writeFiles(t, dir, map[string]string{"sub/mod.txt": "changed\n", "sub/deep/n.txt": "n\n", "top.txt": "changed\n"})
+
+	entries, err := gitStatus(filepath.Join(dir, "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []gitStatusEntry{
+		{XY: ".M", Path: "mod.txt"},
+		{XY: "R.", Path: "new.txt", From: "old.txt"},
+		{XY: "??", Path: "deep/n.txt"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("gitStatus = %+v, want %+v", entries, want)
+	}
+
+	if _, err := gitStatus(t.TempDir()); err == nil {
+		t.Error("gitStatus outside of a repository succeeded")
+	}
+}
+
+func TestParseGitChanges(t *testing.T) {
+	tests := []struct {
+		output string
+		want   []gitChange
+	}{
+		{"", nil},
+		{"M\x00a.go\x00", []gitChange{{Status: 'M', Path: "a.go"}}},
+		{
+			"A\x00new.go\x00R087\x00old name.go\x00new name.go\x00D\x00gone.go\x00",
+			[]gitChange{
+				{Status: 'A', Path: "new.go"},
+				{Status: 'R', Path: "new name.go", From: "old name.go"},
+				{Status: 'D', Path: "gone.go"},
+			},
+		},
+		{"C100\x00a.go\x00b.go\x00M\x00c.go\x00", []gitChange{{Status: 'C', Path: "b.go", From: "a.go"}, {Status: 'M', Path: "c.go"}}},
+	}
+	for _, tt := range tests {
+		if got := parseGitChanges(tt.output); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseGitChanges(%q) = %+v, want %+v", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestGitChanges(t *testing.T) {
+	dir := newIgnoreRepo(t, map[string]string{
+		"sub/old.txt":  "a\nb\nc\nd\n",
+		"sub/keep.txt": "keep\n",
+		"sub/gone.txt": "gone\n",
+		"top.txt":      "top\n",
+	})
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-q", "-m", "one")
+	git(t, dir, "mv", "sub/old.txt", "sub/new.txt")
+	git(t, dir, "rm", "-q", "sub/gone.txt")
+	writeFiles(t, dir, map[string]string{"sub/keep.txt": "changed\n", "top.txt": "changed\n"})
+	git(t, dir, "add", ".")
+
+	args, err := gitDiff{Staged: true}.args(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := gitChanges(filepath.Join(dir, "sub"), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []gitChange{
+		{Status: 'D', Path: "gone.txt"},
+		{Status: 'M', Path: "keep.txt"},
+		{Status: 'R', Path: "new.txt", From: "old.txt"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("gitChanges = %+v, want %+v", changes, want)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	keywordStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#FB4934"))
+	stringStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#B8BB26"))
+	commentStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#928374")).Italic(true)
+	numberStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#D3869B"))
+)
+
+// syntax describes just enough of a language to color it line by line:
+// keywords, comments, strings and numbers. Quotes in multiline may span
+// lines, like Go raw strings.
+type syntax struct {
+	keywords    map[string]bool
+	lineComment string
+	blockStart  string
+	blockEnd    string
+	quotes      string
+	multiline   string
+}
+
+func keywordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+var cLikeKeywords = "if else for while do switch case default break continue return goto " +
+	"struct union enum typedef static const extern void int char long short float double " +
+	"unsigned signed sizeof inline volatile true false NULL nullptr"
+
+var syntaxes = map[string]*syntax{
+	"go": {
+		keywords: keywordSet("break case chan const continue default defer else fallthrough for func go goto if " +
+			"import interface map package range return select struct switch type var " +
+			"true false nil iota bool byte rune string int int8 int16 int32 int64 uint uint8 uint16 " +
+			"uint32 uint64 uintptr float32 float64 error any make new len cap append panic recover"),
+		lineComment: "//", blockStart: "/*", blockEnd: "*/", quotes: "\"'`", multiline: "`",
+	},
+	"python": {
+		keywords: keywordSet("and as assert async await break class continue def del elif else except finally for " +
+			"from global if import in is lambda nonlocal not or pass raise return try while with yield " +
+			"True False None self"),
+		lineComment: "#", quotes: "\"'",
+	},
+	"javascript": {
+		keywords: keywordSet("async await break case catch class const continue debugger default delete do else " +
+			"export extends finally for function if import in instanceof let new of return static super " +
+			"switch this throw try typeof var void while yield true false null undefined"),
+		lineComment: "//", blockStart: "/*", blockEnd: "*/", quotes: "\"'`", multiline: "`",
+	},
+	"typescript": {
+		keywords: keywordSet("async await break case catch class const continue default delete do else enum " +
+			"export extends finally for function if implements import in instanceof interface let new of " +
+			"private protected public readonly return static super switch this throw try type typeof var " +
+			"void while yield true false null undefined string number boolean any unknown never"),
+		lineComment: "//", blockStart: "/*", blockEnd: "*/", quotes: "\"'`", multiline: "`",
+	},
+	"rust": {
+		keywords: keywordSet("as async await break const continue crate dyn else enum extern false fn for if impl " +
+			"in let loop match mod move mut pub ref return self Self static struct super trait true type " +
+			"unsafe use where while i8 i16 i32 i64 u8 u16 u32 u64 usize isize f32 f64 bool str String"),
+		lineComment: "//", blockStart: "/*", blockEnd: "*/", quotes: "\"",
+	},
+	"c": {
+		keywords:    keywordSet(cLikeKeywords),
+		lineComment: "//", blockStart: "/*", blockEnd: "*/", quotes: "\"'",
+	},
+	"cpp": {
+		keywords: keywordSet(cLikeKeywords + " class namespace template typename public private protected " +
+			"virtual override new delete this using auto try catch throw bool"),
+		lineComment: "//", blockStart: "/*", blockEnd: "*/", quotes: "\"'",
+	},
+	"java": {
+		keywords: keywordSet("abstract boolean break byte case catch char class const continue default do double " +
+			"else enum extends final finally float for if implements import instanceof int interface long " +
+			"new package private protected public return short static super switch this throw throws try " +
+			"void while true false null var"),
+		lineComment: "//", blockStart: "/*", blockEnd: "*/", quotes: "\"'",
+	},
+	"bash": {
+		keywords: keywordSet("if then else elif fi for while until do done case esac in function return " +
+			"local export readonly exit"),
+		lineComment: "#", quotes: "\"'",
+	},
+	"ruby": {
+		keywords: keywordSet("begin end def class module if elsif else unless while until for in do return " +
+			"yield self nil true false and or not rescue ensure raise require"),
+		lineComment: "#", quotes: "\"'",
+	},
+	"lua": {
+		keywords: keywordSet("and break do else elseif end false for function if in local nil not or repeat " +
+			"return then true until while"),
+		lineComment: "--", quotes: "\"'",
+	},
+	"sql": {
+		keywords: keywordSet("select from where insert into values update set delete create table drop alter " +
+			"join left right inner outer on group by order having limit and or not null as index primary key " +
+			"SELECT FROM WHERE INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER JOIN LEFT RIGHT " +
+			"INNER OUTER ON GROUP BY ORDER HAVING LIMIT AND OR NOT NULL AS INDEX PRIMARY KEY"),
+		lineComment: "--", blockStart: "/*", blockEnd: "*/", quotes: "'\"",
+	},
+	"comments": {
+		keywords:    keywordSet("true false null"),
+		lineComment: "#", quotes: "\"'",
+	},
+}
+
+// syntaxFor returns the syntax of a language as named by languageForPath,
+// or nil for plain text.
+func syntaxFor(language string) *syntax {
+	switch language {
+	case "jsx":
+		language = "javascript"
+	case "tsx":
+		language = "typescript"
+	case "csharp", "kotlin", "swift", "scala", "dart":
+		language = "java"
+	case "zsh", "fish", "makefile", "dockerfile", "powershell":
+		language = "bash"
+	case "toml", "yaml", "elixir":
+		language = "comments"
+	}
+	return syntaxes[language]
+}
+
+// highlightLines colors lines with syn. Block comments and multiline
+// strings are carried from one line to the next.
+func highlightLines(lines []string, syn *syntax) []string {
+	if syn == nil {
+		return lines
+	}
+	out := make([]string, len(lines))
+	inBlock := false
+	var inQuote byte
+	for i, line := range lines {
+		out[i], inBlock, inQuote = highlightLine(line, syn, inBlock, inQuote)
+	}
+	return out
+}
+
+func highlightLine(line string, syn *syntax, inBlock bool, inQuote byte) (string, bool, byte) {
+	var sb strings.Builder
+	i := 0
+
+	if inBlock {
+		end := strings.Index(line, syn.blockEnd)
+		if end == -1 {
+			return commentStyle.Render(line), true, 0
+		}
+		i = end + len(syn.blockEnd)
+		sb.WriteString(commentStyle.Render(line[:i]))
+	}
+	if inQuote != 0 {
+		end := strings.IndexByte(line, inQuote)
+		if end == -1 {
+			return stringStyle.Render(line), false, inQuote
+		}
+		i = end + 1
+		sb.WriteString(stringStyle.Render(line[:i]))
+	}
+
+	for i < len(line) {
+		rest := line[i:]
+		c := line[i]
+		switch {
+		case syn.lineComment != "" && strings.HasPrefix(rest, syn.lineComment):
+			sb.WriteString(commentStyle.Render(rest))
+			return sb.String(), false, 0
+		case syn.blockStart != "" && strings.HasPrefix(rest, syn.blockStart):
+			end := strings.Index(rest[len(syn.blockStart):], syn.blockEnd)
+			if end == -1 {
+				sb.WriteString(commentStyle.Render(rest))
+				return sb.String(), true, 0
+			}
+			n := len(syn.blockStart) + end + len(syn.blockEnd)
+			sb.WriteString(commentStyle.Render(rest[:n]))
+			i += n
+		case strings.IndexByte(syn.quotes, c) != -1:
+			j := 1
+			for j < len(rest) && rest[j] != c {
+				if rest[j] == '\\' && c != '`' {
+					j++
+				}
+				j++
+			}
+			if j >= len(rest) {
+				sb.WriteString(stringStyle.Render(rest))
+				if strings.IndexByte(syn.multiline, c) != -1 {
+					return sb.String(), false, c
+				}
+				return sb.String(), false, 0
+			}
+			sb.WriteString(stringStyle.Render(rest[:j+1]))
+			i += j + 1
+		case isIdentStart(c):
+			j := 1
+			for j < len(rest) && (isIdentStart(rest[j]) || isDigit(rest[j])) {
+				j++
+			}
+			word := rest[:j]
+			if syn.keywords[word] {
+				sb.WriteString(keywordStyle.Render(word))
+			} else {
+				sb.WriteString(word)
+			}
+			i += j
+		case isDigit(c):
+			j := 1
+			for j < len(rest) && (isDigit(rest[j]) || isIdentStart(rest[j]) || rest[j] == '.') {
+				j++
+			}
+			sb.WriteString(numberStyle.Render(rest[:j]))
+			i += j
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String(), false, 0
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The history journal keeps the selections of the project, oldest first and
+// one JSON entry per line, so earlier selections can be restored across runs.
+// A change appends a line. Once the journal holds twice maxHistoryEntries it
+// is cut back to the last maxHistoryEntries.
+const historyFileName = ".punjado.history"
+const maxHistoryEntries = 100
+
+type historyEntry struct {
+	Time      time.Time `json:"time"`
+	Selection []string  `json:"selection"`
+}
+
+func (e historyEntry) selectionMap() map[string]Selection {
+	return parseSelectionFile([]byte(strings.Join(e.Selection, "\n")))
+}
+
+// readHistory returns the last maxHistoryEntries entries of the journal.
+// Lines that can't be read are skipped.
+func readHistory(dir string) []historyEntry {
+	data, err := os.ReadFile(filepath.Join(dir, historyFileName))
+	if err != nil {
+		return nil
+	}
+	var entries []historyEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		var entry historyEntry
+		if strings.TrimSpace(line) == "" || json.Unmarshal([]byte(line), &entry) != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) > maxHistoryEntries {
+		entries = entries[len(entries)-maxHistoryEntries:]
+	}
+	return entries
+}
+
+func formatHistoryEntry(entry historyEntry) []byte {
+	data, _ := json.Marshal(entry)
+	return append(data, '\n')
+}
+
+func writeHistory(dir string, entries []historyEntry) {
+	var data []byte
+	for _, entry := range entries {
+		data = append(data, formatHistoryEntry(entry)...)
+	}
+	os.WriteFile(filepath.Join(dir, historyFileName), data, 0644)
+}
+
+func appendHistory(dir string, entry historyEntry) {
+	f, err := os.OpenFile(filepath.Join(dir, historyFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(formatHistoryEntry(entry))
+}
+
+// recordHistory appends the selection to the journal of dir, whose entries
+// are given, unless it is the same as the most recent entry. It returns the
+// entries with the selection added.
+func recordHistory(dir string, entries []historyEntry, selected map[string]Selection) []historyEntry {
+	lines := make([]string, 0, len(selected))
+	for _, sel := range selectionList(selected) {
+		lines = append(lines, sel.entryLine())
+	}
+	if len(entries) > 0 && slices.Equal(entries[len(entries)-1].Selection, lines) {
+		return entries
+	}
+
+	entry := historyEntry{Time: time.Now(), Selection: lines}
+	entries = append(entries, entry)
+	if len(entries) >= 2*maxHistoryEntries {
+		entries = entries[len(entries)-maxHistoryEntries:]
+		writeHistory(dir, entries)
+		return entries
+	}
+	appendHistory(dir, entry)
+	return entries
+}
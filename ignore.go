@@ -0,0 +1,375 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const punjadoIgnoreFile = ".punjadoignore"
+
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreRuleSet holds the rules of one ignore file. base is the slash separated
+// directory (relative to the repo root) the patterns are relative to.
+type ignoreRuleSet struct {
+	base  string
+	rules []ignoreRule
+}
+
+// IgnoreMatcher answers whether a path of the project is ignored by git, by
+// the ignore.patterns setting or by the project's .punjadoignore file.
+// Nested .gitignore files are loaded lazily, the first time a path below
+// them is checked.
+type IgnoreMatcher struct {
+	root     string
+	repoRoot string
+
+	global   []*ignoreRuleSet
+	config   *ignoreRuleSet
+	project  *ignoreRuleSet
+	dirRules map[string]*ignoreRuleSet
+	dirCache map[string]bool
+}
+
+func NewIgnoreMatcher(rootPath string) *IgnoreMatcher {
+	root, err := filepath.Abs(rootPath)
+	if err != nil {
+		root = rootPath
+	}
+	m := &IgnoreMatcher{
+		root:     root,
+		repoRoot: findRepoRoot(root),
+		dirRules: make(map[string]*ignoreRuleSet),
+		dirCache: make(map[string]bool),
+	}
+
+	if excludesFile := globalExcludesFile(m.repoRoot); excludesFile != "" {
+		if set := loadIgnoreFile(excludesFile, ""); set != nil {
+			m.global = append(m.global, set)
+		}
+	}
+	if set := loadIgnoreFile(filepath.Join(m.repoRoot, ".git", "info", "exclude"), ""); set != nil {
+		m.global = append(m.global, set)
+	}
+
+	base, err := filepath.Rel(m.repoRoot, m.root)
+	if err != nil || base == "." {
+		base = ""
+	}
+	m.project = loadIgnoreFile(filepath.Join(m.root, punjadoIgnoreFile), filepath.ToSlash(base))
+
+	if patterns := loadConfig(m.root, nil).GetList("ignore.patterns"); len(patterns) > 0 {
+		m.config = &ignoreRuleSet{base: filepath.ToSlash(base)}
+		for _, pattern := range patterns {
+			if rule, ok := parseIgnoreLine(pattern); ok {
+				m.config.rules = append(m.config.rules, rule)
+			}
+		}
+	}
+	return m
+}
+
+// findRepoRoot walks up from dir looking for a .git entry. When dir is not
+// inside a repository, dir itself is used as the root.
+func findRepoRoot(dir string) string {
+	current := dir
+	for {
+		if FileExists(filepath.Join(current, ".git")) {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir
+		}
+		current = parent
+	}
+}
+
+func globalExcludesFile(repoRoot string) string {
+	cmd := exec.Command("git", "config", "--path", "--get", "core.excludesFile")
+	cmd.Dir = repoRoot
+	if output, err := cmd.Output(); err == nil {
+		if p := strings.TrimSpace(string(output)); p != "" {
+			return p
+		}
+	}
+
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "ignore")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "git", "ignore")
+	}
+	return ""
+}
+
+func loadIgnoreFile(filePath string, base string) *ignoreRuleSet {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil
+	}
+	set := &ignoreRuleSet{base: base}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rule, ok := parseIgnoreLine(line); ok {
+			set.rules = append(set.rules, rule)
+		}
+	}
+	return set
+}
+
+func parseIgnoreLine(line string) (ignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	line = trimUnescapedSpaces(line)
+	if line == "" || line[0] == '#' {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{}
+	if line[0] == '!' {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	// A slash anywhere but at the end anchors the pattern to the directory of
+	// the ignore file, otherwise it matches at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if !anchored && !strings.HasPrefix(line, "**") {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+func trimUnescapedSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// globToRegexp translates a gitignore style glob into a regular expression
+// (without anchors). "*" and "?" never match "/", "**" spans directories.
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				atStart := i == 0 || glob[i-1] == '/'
+				j := i
+				for j < len(glob) && glob[j] == '*' {
+					j++
+				}
+				if atStart && j == len(glob) {
+					sb.WriteString(".*")
+					i = j - 1
+					continue
+				}
+				if atStart && glob[j] == '/' {
+					sb.WriteString("(?:.*/)?")
+					i = j
+					continue
+				}
+				sb.WriteString("[^/]*")
+				i = j - 1
+				continue
+			}
+			sb.WriteString("[^/]*")
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end == -1 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
+
+// Match reports whether relPath (relative to the project root) is ignored.
+// A path is ignored as well when any of its parent directories is.
+func (m *IgnoreMatcher) Match(relPath string, isDir bool) bool {
+	repoRel, ok := m.repoRelative(relPath)
+	if !ok {
+		return false
+	}
+
+	parts := strings.Split(repoRel, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.dirIgnored(strings.Join(parts[:i], "/")) {
+			return true
+		}
+	}
+	return m.matchOne(repoRel, isDir)
+}
+
+func (m *IgnoreMatcher) repoRelative(relPath string) (string, bool) {
+	abs := relPath
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(m.root, relPath)
+	}
+	rel, err := filepath.Rel(m.repoRoot, abs)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func (m *IgnoreMatcher) dirIgnored(dir string) bool {
+	if ignored, ok := m.dirCache[dir]; ok {
+		return ignored
+	}
+	ignored := m.matchOne(dir, true)
+	m.dirCache[dir] = ignored
+	return ignored
+}
+
+func (m *IgnoreMatcher) matchOne(repoRel string, isDir bool) bool {
+	ignored := false
+	apply := func(set *ignoreRuleSet) {
+		subject := repoRel
+		if set.base != "" {
+			if !strings.HasPrefix(repoRel, set.base+"/") {
+				return
+			}
+			subject = strings.TrimPrefix(repoRel, set.base+"/")
+		}
+		for _, rule := range set.rules {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if rule.re.MatchString(subject) {
+				ignored = !rule.negate
+			}
+		}
+	}
+
+	for _, set := range m.global {
+		apply(set)
+	}
+
+	dir := path.Dir(repoRel)
+	dirs := []string{""}
+	if dir != "." {
+		parts := strings.Split(dir, "/")
+		for i := 1; i <= len(parts); i++ {
+			dirs = append(dirs, strings.Join(parts[:i], "/"))
+		}
+	}
+	for _, d := range dirs {
+		if set := m.gitignoreFor(d); set != nil {
+			apply(set)
+		}
+	}
+
+	// The configured patterns and the project ignore file are applied last so
+	// they can override git.
+	if m.config != nil {
+		apply(m.config)
+	}
+	if m.project != nil {
+		apply(m.project)
+	}
+	return ignored
+}
+
+func (m *IgnoreMatcher) gitignoreFor(dir string) *ignoreRuleSet {
+	if set, ok := m.dirRules[dir]; ok {
+		return set
+	}
+	set := loadIgnoreFile(filepath.Join(m.repoRoot, filepath.FromSlash(dir), ".gitignore"), dir)
+	m.dirRules[dir] = set
+	return set
+}
+
+func readIgnorePatterns(dir string) []string {
+	data, err := os.ReadFile(filepath.Join(dir, punjadoIgnoreFile))
+	if err != nil {
+		return nil
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if s := strings.TrimSpace(line); s != "" && s[0] != '#' {
+			patterns = append(patterns, s)
+		}
+	}
+	return patterns
+}
+
+func addIgnorePattern(dir string, pattern string) (bool, error) {
+	for _, p := range readIgnorePatterns(dir) {
+		if p == pattern {
+			return false, nil
+		}
+	}
+	path := filepath.Join(dir, punjadoIgnoreFile)
+	data, _ := os.ReadFile(path)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	data = append(data, []byte(pattern+"\n")...)
+	return true, os.WriteFile(path, data, 0644)
+}
+
+// removeIgnorePattern drops every line equal to pattern, keeping comments and
+// the order of the remaining lines intact.
+func removeIgnorePattern(dir string, pattern string) (bool, error) {
+	path := filepath.Join(dir, punjadoIgnoreFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, nil
+	}
+	removed := false
+	var kept []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == pattern {
+			removed = true
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if !removed {
+		return false, nil
+	}
+	return true, os.WriteFile(path, []byte(strings.Join(kept, "\n")), 0644)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+type ignoreCase struct {
+	path  string
+	isDir bool
+	want  bool
+}
+
+// isolateUserConfig keeps the user's own git and punjado configuration out
+// of a test.
+func isolateUserConfig(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+}
+
+// newIgnoreRepo creates a git repository holding files, with the user's
+// own git and punjado configuration kept out of it.
+func newIgnoreRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	isolateUserConfig(t)
+
+	dir := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	writeFiles(t, dir, files)
+	return dir
+}
+
+func TestIgnoreMatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		cases []ignoreCase
+	}{
+		{
+			name:  "unanchored pattern matches at any depth",
+			files: map[string]string{".gitignore": "*.log\n"},
+			cases: []ignoreCase{
+				{"a.log", false, true},
+				{"sub/deep/b.log", false, true},
+				{"a.txt", false, false},
+			},
+		},
+		{
+			name:  "negation re-includes",
+			files: map[string]string{".gitignore": "*.log\n!keep.log\n"},
+			cases: []ignoreCase{
+				{"x.log", false, true},
+				{"keep.log", false, false},
+				{"sub/keep.log", false, false},
+			},
+		},
+		{
+			name:  "later rule wins",
+			files: map[string]string{".gitignore": "!keep.log\n*.log\n"},
+			cases: []ignoreCase{
+				{"keep.log", false, true},
+			},
+		},
+		{
+			name:  "slash anchors to the ignore file",
+			files: map[string]string{".gitignore": "/build\ndocs/out\n"},
+			cases: []ignoreCase{
+				{"build", true, true},
+				{"sub/build", true, false},
+				{"docs/out", true, true},
+				{"sub/docs/out", true, false},
+			},
+		},
+		{
+			name:  "double star",
+			files: map[string]string{".gitignore": "**/tmp\nlogs/**\na/**/z\n"},
+			cases: []ignoreCase{
+				{"tmp", true, true},
+				{"x/y/tmp", true, true},
+				{"logs/a/b.txt", false, true},
+				{"logs", true, false},
+				{"a/z", false, true},
+				{"a/b/c/z", false, true},
+				{"b/a/z", false, false},
+			},
+		},
+		{
+			name:  "single star and question mark stay in one directory",
+			files: map[string]string{".gitignore": "/src/*.gen\nfile?.txt\n"},
+			cases: []ignoreCase{
+				{"src/a.gen", false, true},
+				{"src/sub/a.gen", false, false},
+				{"file1.txt", false, true},
+				{"file12.txt", false, false},
+			},
+		},
+		{
+			name:  "trailing slash only matches directories",
+			files: map[string]string{".gitignore": "cache/\n"},
+			cases: []ignoreCase{
+				{"cache", true, true},
+				{"x/cache", true, true},
+				{"cache", false, false},
+				{"cache/entry.bin", false, true},
+			},
+		},
+		{
+			name:  "files in an ignored directory can't be re-included",
+			files: map[string]string{".gitignore": "out/\n!out/keep.txt\n"},
+			cases: []ignoreCase{
+				{"out/keep.txt", false, true},
+			},
+		},
+		{
+			name:  "escapes, comments and trailing spaces",
+			files: map[string]string{".gitignore": "# comment\n\\#hash\n\\!bang\nspaced   \n"},
+			cases: []ignoreCase{
+				{"# comment", false, false},
+				{"#hash", false, true},
+				{"!bang", false, true},
+				{"spaced", false, true},
+			},
+		},
+		{
+			name: "nested gitignore is relative to its directory",
+			files: map[string]string{
+				".gitignore":     "*.tmp\n",
+				"sub/.gitignore": "!keep.tmp\n/local.txt\n",
+			},
+			cases: []ignoreCase{
+				{"keep.tmp", false, true},
+				{"sub/keep.tmp", false, false},
+				{"sub/other.tmp", false, true},
+				{"sub/local.txt", false, true},
+				{"sub/deeper/local.txt", false, false},
+				{"local.txt", false, false},
+			},
+		},
+		{
+			name: "deeper gitignore takes precedence",
+			files: map[string]string{
+				".gitignore":            "!*.gen\n",
+				"sub/.gitignore":        "*.gen\n",
+				"sub/deeper/.gitignore": "!ok.gen\n",
+			},
+			cases: []ignoreCase{
+				{"a.gen", false, false},
+				{"sub/a.gen", false, true},
+				{"sub/deeper/ok.gen", false, false},
+				{"sub/deeper/b.gen", false, true},
+			},
+		},
+		{
+			name:  "info/exclude",
+			files: map[string]string{".git/info/exclude": "secret.txt\n"},
+			cases: []ignoreCase{
+				{"secret.txt", false, true},
+				{"sub/secret.txt", false, true},
+			},
+		},
+		{
+			name: "gitignore overrides info/exclude",
+			files: map[string]string{
+				".git/info/exclude": "*.txt\n",
+				".gitignore":        "!notes.txt\n",
+			},
+			cases: []ignoreCase{
+				{"a.txt", false, true},
+				{"notes.txt", false, false},
+			},
+		},
+		{
+			name: "punjadoignore overrides git",
+			files: map[string]string{
+				".gitignore":     "*.log\n",
+				".punjadoignore": "!important.log\ndocs/\n",
+			},
+			cases: []ignoreCase{
+				{"a.log", false, true},
+				{"important.log", false, false},
+				{"docs/readme.md", false, true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewIgnoreMatcher(newIgnoreRepo(t, tt.files))
+			for _, c := range tt.cases {
+				if got := m.Match(c.path, c.isDir); got != c.want {
+					t.Errorf("Match(%q, dir=%v) = %v, want %v", c.path, c.isDir, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestIgnoreCoreExcludesFile(t *testing.T) {
+	dir := newIgnoreRepo(t, map[string]string{".gitignore": "!keep.bak\n"})
+	excludes := filepath.Join(t.TempDir(), "excludes")
+	if err := os.WriteFile(excludes, []byte("*.bak\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("git", "-C", dir, "config", "core.excludesFile", excludes).CombinedOutput(); err != nil {
+		t.Fatalf("git config: %v\n%s", err, out)
+	}
+
+	m := NewIgnoreMatcher(dir)
+	for _, c := range []ignoreCase{
+		{"a.bak", false, true},
+		{"sub/b.bak", false, true},
+		{"keep.bak", false, false},
+	} {
+		if got := m.Match(c.path, c.isDir); got != c.want {
+			t.Errorf("Match(%q) = %v, want %v", c.path, got, c.want)
+		}
+	}
+}
+
+func TestIgnoreProjectInSubdirectory(t *testing.T) {
+	dir := newIgnoreRepo(t, map[string]string{
+		".gitignore":             "/top.txt\n",
+		"app/.gitignore":         "*.gen\n",
+		"app/.punjadoignore":     "/vendor/\n",
+		"app/src/main.go":        "",
+		"app/vendor/lib/x.go":    "",
+		"app/nested/vendor/y.go": "",
+	})
+
+	m := NewIgnoreMatcher(filepath.Join(dir, "app"))
+	for _, c := range []ignoreCase{
+		{"src/a.gen", false, true},
+		{"src/main.go", false, false},
+		{"vendor/lib/x.go", false, true},
+		{"nested/vendor/y.go", false, false},
+		{"top.txt", false, false},
+	} {
+		if got := m.Match(c.path, c.isDir); got != c.want {
+			t.Errorf("Match(%q) = %v, want %v", c.path, got, c.want)
+		}
+	}
+}
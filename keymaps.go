@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type commandDoc struct {
+	cmdKey string
+	group  string
+	desc   string
+}
+
+// commandDocs describes the commands for the help panel, in display order.
+var commandDocs = []commandDoc{
+	{moveUpCmdKey, "NAVIGATION", "Up"},
+	{moveDownCmdKey, "NAVIGATION", "Down"},
+	{pageUpCmdKey, "NAVIGATION", "Page Up"},
+	{pageDownCmdKey, "NAVIGATION", "Page Down"},
+	{gotoTopCmdKey, "NAVIGATION", "Go to Top"},
+	{gotoBottomCmdKey, "NAVIGATION", "Go to Bottom"},
+	{toggleDirectoryCmdKey, "NAVIGATION", "Open Dir/Symbols"},
+	{toggleExpandAllCmdKey, "NAVIGATION", "Expand All"},
+	{toggleSelectedModeCmdKey, "NAVIGATION", "Selected Only"},
+	{sortByNameCmdKey, "NAVIGATION", "Sort by Name"},
+	{sortBySizeCmdKey, "NAVIGATION", "Sort by Size"},
+	{sortByTokensCmdKey, "NAVIGATION", "Sort by Tokens"},
+	{sortByMtimeCmdKey, "NAVIGATION", "Sort by Mtime"},
+	{searchCmdKey, "NAVIGATION", "Search"},
+	{nextMatchCmdKey, "NAVIGATION", "Next Match"},
+	{prevMatchCmdKey, "NAVIGATION", "Prev Match"},
+	{toggleFileCmdKey, "SELECTION", "Select File"},
+	{toggleAllCmdKey, "SELECTION", "Toggle All"},
+	{cycleOutlineCmdKey, "SELECTION", "Full/Outline"},
+	{undoCmdKey, "SELECTION", "Undo"},
+	{redoCmdKey, "SELECTION", "Redo"},
+	{selectMatchesCmdKey, "SELECTION", "Select Matches"},
+	{selectDepsCmdKey, "SELECTION", "Select Imports"},
+	{selectDependentsCmdKey, "SELECTION", "Select Dependents"},
+	{selectPatternCmdKey, "SELECTION", "Select Pattern"},
+	{deselectPatternCmdKey, "SELECTION", "Deselect Pattern"},
+	{openProfilesCmdKey, "SELECTION", "Profiles"},
+	{copyContextCmdKey, "ACTIONS", "Copy"},
+	{previewContextCmdKey, "ACTIONS", "Preview Copy"},
+	{togglePaneCmdKey, "ACTIONS", "File Preview"},
+	{focusPaneCmdKey, "ACTIONS", "Focus Preview"},
+	{toggleIgnoredCmdKey, "ACTIONS", "Show Ignored"},
+	{toggleHelpCmdKey, "ACTIONS", "Help"},
+	{closeHelpCmdKey, "ACTIONS", "Close Help/Search"},
+	{quitCmdKey, "ACTIONS", "Quit"},
+}
+
+var helpGroups = []string{"NAVIGATION", "SELECTION", "ACTIONS"}
+
+// keyAliases maps alternative spellings inside <...> to the names bubbletea
+// uses for keys.
+var keyAliases = map[string]string{
+	"cr":       "enter",
+	"return":   "enter",
+	"escape":   "esc",
+	"bs":       "backspace",
+	"del":      "delete",
+	"pageup":   "pgup",
+	"pagedown": "pgdown",
+}
+
+// initKeymaps starts from defaultKeymaps and applies the keymaps.<command>
+// settings, each replacing all keys of that command. An empty list unbinds
+// the command. Unknown commands, keys bound twice and sequences that are a
+// prefix of another sequence are reported as errors.
+func initKeymaps(cfg *Config) (map[string]Keymap, error) {
+	bindings := make(map[string][]string)
+	var order []string
+	for _, item := range defaultKeymaps {
+		if _, ok := bindings[item.cmdKey]; !ok {
+			order = append(order, item.cmdKey)
+		}
+		bindings[item.cmdKey] = append(bindings[item.cmdKey], item.keys)
+	}
+
+	for _, key := range cfg.Keys() {
+		cmdKey, found := strings.CutPrefix(key, "keymaps.")
+		if !found {
+			continue
+		}
+		if _, ok := commandRegistry[cmdKey]; !ok {
+			return nil, fmt.Errorf("keymaps.%s: unknown command '%s'", cmdKey, cmdKey)
+		}
+		var keys []string
+		for _, raw := range cfg.GetList(key) {
+			seq, err := normalizeKeySeq(raw)
+			if err != nil {
+				return nil, fmt.Errorf("keymaps.%s: %v", cmdKey, err)
+			}
+			keys = append(keys, seq)
+		}
+		if _, ok := bindings[cmdKey]; !ok {
+			order = append(order, cmdKey)
+		}
+		bindings[cmdKey] = keys
+	}
+
+	fastLookupMap := make(map[string]Keymap)
+	for _, cmdKey := range order {
+		for _, keys := range bindings[cmdKey] {
+			if other, ok := fastLookupMap[keys]; ok && other.cmdKey != cmdKey {
+				return nil, fmt.Errorf("key '%s' is bound to both '%s' and '%s'", keyLabel(keys), other.cmdKey, cmdKey)
+			}
+			fastLookupMap[keys] = Keymap{keys: keys, cmdKey: cmdKey}
+		}
+	}
+
+	if err := checkAmbiguousPrefixes(fastLookupMap); err != nil {
+		return nil, err
+	}
+	return fastLookupMap, nil
+}
+
+// checkAmbiguousPrefixes rejects a sequence that starts another one, like "g"
+// and "gg": the shorter one would always run before the longer can be typed.
+func checkAmbiguousPrefixes(keymaps map[string]Keymap) error {
+	seqs := make([]string, 0, len(keymaps))
+	for seq := range keymaps {
+		seqs = append(seqs, seq)
+	}
+	sort.Strings(seqs)
+
+	for _, a := range seqs {
+		tokensA := splitKeySeq(a)
+		for _, b := range seqs {
+			tokensB := splitKeySeq(b)
+			if len(tokensA) >= len(tokensB) {
+				continue
+			}
+			prefix := true
+			for i := range tokensA {
+				if tokensA[i] != tokensB[i] {
+					prefix = false
+					break
+				}
+			}
+			if prefix {
+				return fmt.Errorf("key '%s' (%s) is a prefix of '%s' (%s)",
+					keyLabel(a), keymaps[a].cmdKey, keyLabel(b), keymaps[b].cmdKey)
+			}
+		}
+	}
+	return nil
+}
+
+// splitKeySeq splits a sequence like "g<ctrl+w>j" into its keys.
+func splitKeySeq(seq string) []string {
+	var tokens []string
+	for len(seq) > 0 {
+		if seq[0] == '<' {
+			if end := strings.IndexByte(seq, '>'); end > 1 {
+				tokens = append(tokens, seq[:end+1])
+				seq = seq[end+1:]
+				continue
+			}
+		}
+		r := []rune(seq)[0]
+		tokens = append(tokens, string(r))
+		seq = seq[len(string(r)):]
+	}
+	return tokens
+}
+
+// normalizeKeySeq turns a configured sequence into the form Update builds
+// from key presses: single characters as is and named keys as <name>, with
+// modifiers as in <ctrl+r> or <alt+j>. Vim style <C-r>, <A-j>, <M-j>, <S-tab>
+// and <space> are accepted too.
+func normalizeKeySeq(raw string) (string, error) {
+	if raw == "" {
+		return "", fmt.Errorf("empty key sequence")
+	}
+	var sb strings.Builder
+	for _, token := range splitKeySeq(raw) {
+		if len(token) < 3 || token[0] != '<' {
+			sb.WriteString(token)
+			continue
+		}
+		name := token[1 : len(token)-1]
+		lower := strings.ToLower(name)
+		for _, mod := range []struct{ vim, tea string }{
+			{"c-", "ctrl+"}, {"a-", "alt+"}, {"m-", "alt+"}, {"s-", "shift+"},
+		} {
+			if strings.HasPrefix(lower, mod.vim) {
+				lower = mod.tea + lower[len(mod.vim):]
+				name = mod.tea + name[len(mod.vim):]
+			}
+		}
+		if lower == "space" {
+			sb.WriteString(" ")
+			continue
+		}
+
+		mods, key := "", name
+		if i := strings.LastIndex(lower, "+"); i != -1 && i < len(lower)-1 {
+			mods, key = lower[:i+1], name[i+1:]
+		}
+		// Named keys are lower case, a single character after a modifier
+		// keeps its case (alt+J differs from alt+j).
+		if len([]rune(key)) > 1 {
+			key = strings.ToLower(key)
+			if alias, ok := keyAliases[key]; ok {
+				key = alias
+			}
+		}
+		if strings.Contains(mods, "ctrl+") {
+			key = strings.ToLower(key)
+		}
+		sb.WriteString("<" + mods + key + ">")
+	}
+	return sb.String(), nil
+}
+
+// keyLabel is how a sequence is shown in the help and footer.
+func keyLabel(seq string) string {
+	var parts []string
+	for _, token := range splitKeySeq(seq) {
+		switch token {
+		case " ":
+			parts = append(parts, "space")
+		case "<up>":
+			parts = append(parts, "↑")
+		case "<down>":
+			parts = append(parts, "↓")
+		case "<left>":
+			parts = append(parts, "←")
+		case "<right>":
+			parts = append(parts, "→")
+		default:
+			if len(token) > 2 && token[0] == '<' {
+				token = token[1 : len(token)-1]
+			}
+			parts = append(parts, token)
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// keysForCommand returns the labels of all sequences bound to cmdKey, in the
+// order of defaultKeymaps followed by the configured ones.
+func keysForCommand(keymaps map[string]Keymap, cmdKey string) []string {
+	var seqs []string
+	for seq, item := range keymaps {
+		if item.cmdKey == cmdKey {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool {
+		pi, pj := defaultKeyIndex(seqs[i]), defaultKeyIndex(seqs[j])
+		if pi != pj {
+			return pi < pj
+		}
+		return seqs[i] < seqs[j]
+	})
+
+	labels := make([]string, len(seqs))
+	for i, seq := range seqs {
+		labels[i] = keyLabel(seq)
+	}
+	return labels
+}
+
+func defaultKeyIndex(seq string) int {
+	for i, item := range defaultKeymaps {
+		if item.keys == seq {
+			return i
+		}
+	}
+	return len(defaultKeymaps)
+}
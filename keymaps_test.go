@@ -0,0 +1,166 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeKeySeq(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "j", want: "j"},
+		{in: "gg", want: "gg"},
+		{in: "<space>", want: " "},
+		{in: "<Space>x", want: " x"},
+		{in: "<C-r>", want: "<ctrl+r>"},
+		{in: "<c-R>", want: "<ctrl+r>"},
+		{in: "<Ctrl+W>j", want: "<ctrl+w>j"},
+		{in: "<A-j>", want: "<alt+j>"},
+		{in: "<M-J>", want: "<alt+J>"},
+		{in: "<alt+J>", want: "<alt+J>"},
+		{in: "<S-Tab>", want: "<shift+tab>"},
+		{in: "<CR>", want: "<enter>"},
+		{in: "<Escape>", want: "<esc>"},
+		{in: "<PageDown>", want: "<pgdown>"},
+		{in: "<c-Del>", want: "<ctrl+delete>"},
+		{in: "g<C-w>", want: "g<ctrl+w>"},
+		{in: "<", want: "<"},
+		{in: "<>", want: "<>"},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeKeySeq(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizeKeySeq(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("normalizeKeySeq(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitKeySeq(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"gg", []string{"g", "g"}},
+		{"g<ctrl+w>j", []string{"g", "<ctrl+w>", "j"}},
+		{"<", []string{"<"}},
+		{"<>x", []string{"<", ">", "x"}},
+		{"é<up>", []string{"é", "<up>"}},
+	}
+	for _, tt := range tests {
+		if got := splitKeySeq(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitKeySeq(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// keymapConfig is a config holding only the given keymaps settings.
+func keymapConfig(keymaps map[string][]string) *Config {
+	c := &Config{values: make(map[string]configValue)}
+	for cmdKey, keys := range keymaps {
+		c.values["keymaps."+cmdKey] = configValue{List: keys, IsList: true, Source: "project"}
+	}
+	return c
+}
+
+func TestInitKeymaps(t *testing.T) {
+	tests := []struct {
+		name    string
+		keymaps map[string][]string
+		bound   map[string]string
+		unbound []string
+		wantErr string
+	}{
+		{
+			name:  "defaults",
+			bound: map[string]string{"j": moveDownCmdKey, "gg": gotoTopCmdKey, " ": toggleFileCmdKey, "<ctrl+r>": redoCmdKey},
+		},
+		{
+			name:    "setting replaces all keys of the command",
+			keymaps: map[string][]string{quitCmdKey: {"<C-q>"}},
+			bound:   map[string]string{"<ctrl+q>": quitCmdKey},
+			unbound: []string{"q", "ZZ"},
+		},
+		{
+			name:    "empty list unbinds",
+			keymaps: map[string][]string{togglePaneCmdKey: {}},
+			unbound: []string{"p"},
+		},
+		{
+			name:    "freed key can be reused",
+			keymaps: map[string][]string{moveDownCmdKey: {"<down>"}, quitCmdKey: {"j"}},
+			bound:   map[string]string{"j": quitCmdKey, "<down>": moveDownCmdKey},
+		},
+		{
+			name:    "unknown command",
+			keymaps: map[string][]string{"jump": {"x"}},
+			wantErr: "unknown command 'jump'",
+		},
+		{
+			name:    "empty key",
+			keymaps: map[string][]string{quitCmdKey: {""}},
+			wantErr: "keymaps.quit: empty key sequence",
+		},
+		{
+			name:    "key bound twice",
+			keymaps: map[string][]string{quitCmdKey: {"<Space>"}},
+			wantErr: "key 'space' is bound to both",
+		},
+		{
+			name:    "sequence is a prefix of another",
+			keymaps: map[string][]string{quitCmdKey: {"g"}},
+			wantErr: "key 'g' (quit) is a prefix of 'g",
+		},
+		{
+			name:    "sequence starts with a shorter one",
+			keymaps: map[string][]string{quitCmdKey: {"jj"}},
+			wantErr: "key 'j' (moveDown) is a prefix of 'jj' (quit)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keymaps, err := initKeymaps(keymapConfig(tt.keymaps))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for seq, cmdKey := range tt.bound {
+				if got := keymaps[seq].cmdKey; got != cmdKey {
+					t.Errorf("%q runs %q, want %q", seq, got, cmdKey)
+				}
+			}
+			for _, seq := range tt.unbound {
+				if item, ok := keymaps[seq]; ok {
+					t.Errorf("%q is still bound to %q", seq, item.cmdKey)
+				}
+			}
+		})
+	}
+}
+
+func TestKeysForCommand(t *testing.T) {
+	keymaps, err := initKeymaps(keymapConfig(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keysForCommand(keymaps, moveDownCmdKey), []string{"j", "↓"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("keysForCommand(moveDown) = %q, want %q", got, want)
+	}
+	if got, want := keysForCommand(keymaps, toggleFileCmdKey), []string{"space", "s"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("keysForCommand(toggleFile) = %q, want %q", got, want)
+	}
+}
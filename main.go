@@ -54,6 +54,18 @@ func main() {
 	case "tokens":
 		HandleTokens(params, flags)
 
+	case "ignore":
+		HandleIgnore(params, flags)
+
+	case "history":
+		HandleHistory(params, flags)
+
+	case "budget":
+		HandleBudget(params, flags)
+
+	case "config":
+		HandleConfig(params, flags)
+
 	default:
 		fmt.Printf("Command '%s' not recognised..\n", subcommand)
 	}
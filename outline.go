@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// outlineError reports why the file at path has no outline, nil when it has
+// one. Only Go, markdown and the languages the highlighter knows are
+// outlined.
+func outlineError(path string) error {
+	language := languageForPath(path)
+	switch {
+	case language == "":
+		return fmt.Errorf("no outline for '%s'", filepath.Base(path))
+	case language != "go" && language != "markdown" && syntaxFor(language) == nil:
+		return fmt.Errorf("no outline for %s files", language)
+	}
+	return nil
+}
+
+// outlineFile reduces the content of a file to its outline: the package
+// clause, imports, type declarations and function signatures with their
+// doc comments. Go files are parsed, other code is outlined line by line
+// and markdown keeps its headings. Files outlineError rejects are returned
+// as they are.
+func outlineFile(path string, content []byte) string {
+	language := languageForPath(path)
+	switch {
+	case language == "go" && strings.HasSuffix(path, ".go"):
+		if outline, ok := outlineGo(content); ok {
+			return outline
+		}
+		return outlineLines(content)
+	case language == "markdown":
+		return outlineMarkdown(content)
+	case syntaxFor(language) != nil:
+		return outlineLines(content)
+	}
+	return string(content)
+}
+
+// outlineGo keeps the package clause, imports, constants and types of a Go
+// file as written, and the signatures of its functions and methods.
+func outlineGo(content []byte) (string, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+	if err != nil {
+		return "", false
+	}
+	source := func(from, to token.Pos) string {
+		return string(content[fset.Position(from).Offset:fset.Position(to).Offset])
+	}
+
+	var parts []string
+	start := file.Package
+	if file.Doc != nil {
+		start = file.Doc.Pos()
+	}
+	parts = append(parts, source(start, file.Name.End()))
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok == token.VAR {
+				continue
+			}
+			start := d.Pos()
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+			parts = append(parts, source(start, d.End()))
+		case *ast.FuncDecl:
+			start := d.Pos()
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+			end := d.End()
+			if d.Body != nil {
+				end = d.Body.Lbrace
+			}
+			parts = append(parts, strings.TrimSpace(source(start, end)))
+		}
+	}
+	return strings.Join(parts, "\n\n") + "\n", true
+}
+
+// outlineDecl matches the lines that declare something in most languages:
+// functions, classes, types, modules and imports.
+var outlineDecl = regexp.MustCompile(`^(export\s+)?(default\s+)?(pub(\([a-z]+\))?\s+)?` +
+	`((public|private|protected|internal|static|abstract|final|override|virtual|async|unsafe|extern|inline|open|sealed|data)\s+)*` +
+	`(func|function\*?|def|fn|class|interface|trait|impl|struct|enum|union|type|typedef|module|mod|namespace|package|import|from|use|require|include|#include|object|protocol|extension|local\s+function)\b`)
+
+// outlineMethod matches methods with modifiers, as in Java or C#, and
+// outlineCFunc unindented C style functions and prototypes.
+var outlineMethod = regexp.MustCompile(`^((public|private|protected|internal|static|final|abstract|override|virtual|async|synchronized)\s+)+[\w<>\[\],.?\s]+\(`)
+var outlineCFunc = regexp.MustCompile(`^[A-Za-z_][\w:<>*&\s]*[\s*&][A-Za-z_][\w:]*\s*\(`)
+
+// outlineComment matches the lines of comments, which are kept in front of
+// a declaration, and decorators.
+var outlineComment = regexp.MustCompile(`^(//|#|/\*|\*|--|@)`)
+
+// isOutlineDecl reports whether a line of code declares something.
+func isOutlineDecl(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	if outlineDecl.MatchString(trimmed) || outlineMethod.MatchString(trimmed) {
+		return true
+	}
+	if line != trimmed || !outlineCFunc.MatchString(line) {
+		return false
+	}
+	switch strings.Fields(line)[0] {
+	case "if", "for", "while", "switch", "return", "else", "do", "case":
+		return false
+	}
+	return true
+}
+
+// outlineLines keeps the declarations of a file with the comments right
+// above them. Bodies are left out, a declaration that opens one is closed
+// with an ellipsis.
+func outlineLines(content []byte) string {
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	var out []string
+	var comments []string
+	for _, line := range lines {
+		switch {
+		case isOutlineDecl(line):
+			out = append(out, comments...)
+			comments = nil
+			line = strings.TrimRight(line, " \t")
+			if strings.HasSuffix(line, "{") {
+				line += " ... }"
+			} else if strings.HasSuffix(line, ":") {
+				line += " ..."
+			}
+			out = append(out, line)
+		case outlineComment.MatchString(strings.TrimSpace(line)):
+			comments = append(comments, line)
+		default:
+			comments = nil
+		}
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	return strings.Join(out, "\n") + "\n"
+}
+
+// outlineMarkdown keeps the headings of a markdown file, skipping code
+// blocks.
+func outlineMarkdown(content []byte) string {
+	var out []string
+	inFence := false
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if !inFence && strings.HasPrefix(trimmed, "#") {
+			out = append(out, line)
+		}
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	return strings.Join(out, "\n") + "\n"
+}
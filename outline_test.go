@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestOutlineError(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"main.go", ""},
+		{"README.md", ""},
+		{"app/models.py", ""},
+		{"Makefile", ""},
+		{"config.toml", ""},
+		{"data.json", "no outline for json files"},
+		{"notes.csv", "no outline for 'notes.csv'"},
+		{"LICENSE", "no outline for 'LICENSE'"},
+	}
+	for _, tt := range tests {
+		got := ""
+		if err := outlineError(tt.path); err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("outlineError(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestOutlineFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		want    string
+	}{
+		{
+			name:    "go keeps declarations and signatures",
+			path:    "a.go",
+			content: "package a\n\nimport \"fmt\"\n\nvar x = 1\n\n// F prints.\nfunc F() {\n\tfmt.Println(x)\n}\n\ntype T struct{ A int }\n",
+			want:    "package a\n\nimport \"fmt\"\n\n// F prints.\nfunc F()\n\ntype T struct{ A int }\n",
+		},
+		{
+			name:    "markdown keeps headings outside of code blocks",
+			path:    "doc.md",
+			content: "# Title\ntext\n```\n# not a heading\n```\n## Part\n",
+			want:    "# Title\n## Part\n",
+		},
+		{
+			name:    "no outline is returned as it is",
+			path:    "data.json",
+			content: "{\"a\": 1}\n",
+			want:    "{\"a\": 1}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := outlineFile(tt.path, []byte(tt.content)); got != tt.want {
+				t.Errorf("outlineFile = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
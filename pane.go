@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// maxPaneBytes is how much of a file the preview pane reads.
+const maxPaneBytes = 2 << 20
+
+// hexDumpBytes is how much of a binary file the pane shows as hex.
+const hexDumpBytes = 512
+
+// filePane previews the file under the cursor next to the tree. cursor is
+// the line the pane is on and anchor where the visual selection started.
+type filePane struct {
+	node   *FileNode
+	lines  []string
+	info   string
+	binary bool
+	offset int
+	cursor int
+	visual bool
+	anchor int
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+func (m model) currentNode() *FileNode {
+	if m.cursor < 0 || m.cursor >= len(m.visibleNodes) {
+		return nil
+	}
+	return m.visibleNodes[m.cursor]
+}
+
+// currentFile is the node under the cursor, or the file of a symbol node.
+func (m model) currentFile() *FileNode {
+	node := m.currentNode()
+	if node != nil && node.Symbol != "" {
+		return node.Parent
+	}
+	return node
+}
+
+// treeWidth is the width of the tree, which leaves the rest to the pane
+// while it is open.
+func (m model) treeWidth() int {
+	if !m.paneOpen {
+		return m.width
+	}
+	return min(max(m.width*2/5, 24), m.width)
+}
+
+func (m model) togglePane() model {
+	m.paneOpen = !m.paneOpen
+	m.paneFocused = false
+	if m.paneOpen {
+		m = m.loadPane()
+	}
+	return m.resizeViewport()
+}
+
+func (m model) focusPane() model {
+	if !m.paneOpen {
+		m = m.togglePane()
+	}
+	node := m.pane.node
+	m.paneFocused = node != nil && !node.IsDir
+	return m
+}
+
+// loadPane reads the file under the cursor into the pane.
+func (m model) loadPane() model {
+	node := m.currentFile()
+	m.pane = filePane{node: node}
+	if node == nil {
+		return m
+	}
+	if node.IsDir {
+		m.pane.info = fmt.Sprintf("%s/  %d entries", node.Name, len(node.Children))
+		return m
+	}
+
+	f, err := os.Open(node.Path)
+	if err != nil {
+		m.pane.info = err.Error()
+		return m
+	}
+	defer f.Close()
+	buf := make([]byte, maxPaneBytes)
+	n, _ := f.Read(buf)
+	content := buf[:n]
+
+	if node.IsBinary {
+		m.pane.binary = true
+		m.pane.info = fmt.Sprintf("%s  %s  binary", node.Name, formatSize(node.Size))
+		m.pane.lines = binarySummary(node, content)
+		return m
+	}
+
+	info := fmt.Sprintf("%s  %s", node.Name, formatSize(node.Size))
+	if tokens, err := m.tokens.CountFile(node.Path, nil); err == nil {
+		info += fmt.Sprintf("  %s tokens", formatTokenCount(tokens))
+	}
+	text := strings.ReplaceAll(string(content), "\t", "    ")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	m.pane.info = info + fmt.Sprintf("  %d lines", len(lines))
+	m.pane.lines = highlightLines(lines, syntaxFor(languageForPath(node.Path)))
+	return m
+}
+
+// binarySummary describes a binary file and dumps its first bytes as hex,
+// like xxd.
+func binarySummary(node *FileNode, content []byte) []string {
+	lines := []string{
+		"Type:     " + http.DetectContentType(content),
+		"Size:     " + fmt.Sprintf("%s (%d bytes)", formatSize(node.Size), node.Size),
+	}
+	if info, err := os.Stat(node.Path); err == nil {
+		lines = append(lines,
+			"Mode:     "+info.Mode().String(),
+			"Modified: "+info.ModTime().Format("2006-01-02 15:04:05"))
+	}
+	lines = append(lines, "")
+
+	dump := content[:min(len(content), hexDumpBytes)]
+	for off := 0; off < len(dump); off += 16 {
+		row := dump[off:min(off+16, len(dump))]
+		var hex, ascii strings.Builder
+		for i := 0; i < 16; i++ {
+			if i < len(row) {
+				fmt.Fprintf(&hex, "%02x ", row[i])
+				if row[i] >= 0x20 && row[i] < 0x7f {
+					ascii.WriteByte(row[i])
+				} else {
+					ascii.WriteByte('.')
+				}
+			} else {
+				hex.WriteString("   ")
+			}
+			if i == 7 {
+				hex.WriteByte(' ')
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%08x  %s %s", off, hex.String(), ascii.String()))
+	}
+	return lines
+}
+
+// paneHeight is the number of file lines the pane shows below its info line.
+func (m model) paneHeight() int {
+	return max(m.viewport.Height-1, 1)
+}
+
+func (m model) renderPane(width int) string {
+	height := m.viewport.Height
+	lineStyle := lipgloss.NewStyle().MaxWidth(width)
+	out := []string{lineStyle.Render(descStyle.Render(m.pane.info))}
+
+	node := m.pane.node
+	visStart, visEnd := m.visualRange()
+	digits := len(fmt.Sprint(len(m.pane.lines)))
+	for i := m.pane.offset; i < len(m.pane.lines) && len(out) < height; i++ {
+		if m.pane.binary {
+			out = append(out, lineStyle.Render(m.pane.lines[i]))
+			continue
+		}
+
+		marker := " "
+		if node != nil && node.Selected && inRanges(node.Ranges, i+1) {
+			marker = partialFileStyle.UnsetMarginRight().Render("▌")
+		}
+		numStyle := emptyDirStyle.UnsetMarginRight()
+		switch {
+		case m.pane.visual && i >= visStart && i <= visEnd:
+			numStyle = numStyle.Background(cursorColor).Foreground(lipgloss.Color("#FAFAFA"))
+		case m.paneFocused && i == m.pane.cursor:
+			numStyle = numStyle.Foreground(lipgloss.Color("#FAFAFA")).Bold(true)
+		}
+		num := numStyle.Render(fmt.Sprintf("%*d ", digits, i+1))
+		out = append(out, lineStyle.Render(marker+num+" "+m.pane.lines[i]))
+	}
+	return lipgloss.NewStyle().Width(width).Height(height).Render(strings.Join(out, "\n"))
+}
+
+func inRanges(ranges []LineRange, line int) bool {
+	for _, r := range ranges {
+		if line >= r.Start && line <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// visualRange returns the first and last line index of the visual selection.
+func (m model) visualRange() (int, int) {
+	return min(m.pane.anchor, m.pane.cursor), max(m.pane.anchor, m.pane.cursor)
+}
+
+func (m model) movePaneCursor(delta int) model {
+	last := max(len(m.pane.lines)-1, 0)
+	m.pane.cursor = min(max(m.pane.cursor+delta, 0), last)
+	if m.pane.cursor < m.pane.offset {
+		m.pane.offset = m.pane.cursor
+	}
+	if m.pane.cursor >= m.pane.offset+m.paneHeight() {
+		m.pane.offset = m.pane.cursor - m.paneHeight() + 1
+	}
+	return m
+}
+
+// updatePane handles the keys while the pane has the focus.
+func (m model) updatePane(keyStr string) model {
+	half := max(m.paneHeight()/2, 1)
+	switch keyStr {
+	case "j", "<down>":
+		m = m.movePaneCursor(1)
+	case "k", "<up>":
+		m = m.movePaneCursor(-1)
+	case "<ctrl+d>":
+		m = m.movePaneCursor(half)
+	case "<ctrl+u>":
+		m = m.movePaneCursor(-half)
+	case "<pgdown>":
+		m = m.movePaneCursor(m.paneHeight())
+	case "<pgup>":
+		m = m.movePaneCursor(-m.paneHeight())
+	case "g":
+		m = m.movePaneCursor(-len(m.pane.lines))
+	case "G":
+		m = m.movePaneCursor(len(m.pane.lines))
+	case "v", "V":
+		if m.pane.binary {
+			break
+		}
+		m.pane.visual = !m.pane.visual
+		m.pane.anchor = m.pane.cursor
+	case " ", "s", "<enter>":
+		if m.pane.visual {
+			m = m.selectPaneRange()
+		}
+	case "<esc>":
+		if m.pane.visual {
+			m.pane.visual = false
+		} else {
+			m.paneFocused = false
+		}
+	case "<tab>":
+		m.pane.visual = false
+		m.paneFocused = false
+	case "p":
+		m = m.togglePane()
+	}
+	return m
+}
+
+// selectPaneRange adds the lines of the visual selection to the file as a
+// single action. A file that was selected as a whole is narrowed down to
+// the lines.
+func (m model) selectPaneRange() model {
+	node := m.pane.node
+	m.pane.visual = false
+	if node == nil || node.IsDir || node.IsBinary || node.Ignored {
+		return m
+	}
+
+	start, end := m.visualRange()
+	r := LineRange{Start: start + 1, End: end + 1}
+	next := []LineRange{r}
+	if node.Selected && len(node.Ranges) > 0 {
+		next = normalizeRanges(append(slices.Clone(node.Ranges), r))
+	}
+
+	prevSelected, prevState := node.Selected, node.state()
+	action := Action{
+		Undo: func() {
+			node.SetSelected(prevSelected)
+			node.setState(prevState)
+		},
+		Redo: func() {
+			node.SetSelected(true)
+			node.setState(fileState{Ranges: next})
+		},
+	}
+	m = m.commit(action)
+	return m.showToast(fmt.Sprintf("Selected %s:%s", node.Name, formatRanges(next)))
+}
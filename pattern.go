@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// PathMatcher picks project files by glob or regular expression. A path
+// matches when any include pattern matches it and no exclude pattern does.
+type PathMatcher struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// compileGlob turns a glob into a regexp over the whole relative path. As in
+// .gitignore, a glob without a slash matches names at any depth, and a glob
+// matching a directory matches everything below it.
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	glob = strings.TrimPrefix(glob, "./")
+	if glob == "" {
+		return nil, fmt.Errorf("empty glob")
+	}
+	prefix := "^"
+	if !strings.Contains(strings.TrimSuffix(glob, "/"), "/") {
+		prefix = "^(?:.*/)?"
+	}
+	glob = strings.Trim(glob, "/")
+	return regexp.Compile(prefix + globToRegexp(glob) + "(?:/.*)?$")
+}
+
+func (p *PathMatcher) AddGlob(glob string, exclude bool) error {
+	re, err := compileGlob(glob)
+	if err != nil {
+		return fmt.Errorf("invalid glob '%s': %v", glob, err)
+	}
+	p.add(re, exclude)
+	return nil
+}
+
+// AddRegex adds an unanchored regular expression, matched against the
+// slash separated relative path.
+func (p *PathMatcher) AddRegex(expr string, exclude bool) error {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid regex '%s': %v", expr, err)
+	}
+	p.add(re, exclude)
+	return nil
+}
+
+func (p *PathMatcher) add(re *regexp.Regexp, exclude bool) {
+	if exclude {
+		p.exclude = append(p.exclude, re)
+	} else {
+		p.include = append(p.include, re)
+	}
+}
+
+func (p *PathMatcher) Match(relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	included := false
+	for _, re := range p.include {
+		if re.MatchString(relPath) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, re := range p.exclude {
+		if re.MatchString(relPath) {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePatternQuery reads the patterns typed into the TUI prompt: globs
+// separated by spaces, "re:" in front of a regular expression and "!" in
+// front of a pattern that excludes, as in "internal/api/** !*_test.go".
+func parsePatternQuery(query string) (*PathMatcher, error) {
+	p := &PathMatcher{}
+	for _, field := range strings.Fields(query) {
+		exclude := strings.HasPrefix(field, "!")
+		field = strings.TrimPrefix(field, "!")
+
+		var err error
+		if expr, ok := strings.CutPrefix(field, "re:"); ok {
+			err = p.AddRegex(expr, exclude)
+		} else {
+			err = p.AddGlob(field, exclude)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(p.include) == 0 {
+		return nil, fmt.Errorf("no pattern to match")
+	}
+	return p, nil
+}
+
+// Files returns the selectable files below root that match, in tree order.
+// Ignored and binary files are left out.
+func (p *PathMatcher) Files(root *FileNode, rootPath string) []*FileNode {
+	var files []*FileNode
+	var traverse func(n *FileNode)
+	traverse = func(n *FileNode) {
+		if n.Ignored || n.IsBinary {
+			return
+		}
+		if !n.IsDir {
+			if rel, err := filepath.Rel(rootPath, n.Path); err == nil && p.Match(rel) {
+				files = append(files, n)
+			}
+		}
+		for _, child := range n.Children {
+			traverse(child)
+		}
+	}
+	traverse(root)
+	return files
+}
+
+// matcherFromFlags builds a PathMatcher from --glob, --regex and --exclude,
+// or returns nil when neither --glob nor --regex is given.
+func matcherFromFlags(flags map[string]string) (*PathMatcher, error) {
+	p := &PathMatcher{}
+	if glob, ok := flags["glob"]; ok {
+		if err := p.AddGlob(glob, false); err != nil {
+			return nil, err
+		}
+	}
+	if expr, ok := flags["regex"]; ok {
+		if err := p.AddRegex(expr, false); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.include) == 0 {
+		if HasFlag(flags, "exclude") {
+			return nil, fmt.Errorf("--exclude needs --glob or --regex")
+		}
+		return nil, nil
+	}
+	if exclude, ok := flags["exclude"]; ok {
+		if err := p.AddGlob(exclude, true); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Profiles are named copies of the .punjado selection kept next to it in the
+// .punjado.profiles directory, one file per profile.
+const profilesDirName = ".punjado.profiles"
+
+func profilePath(dir string, name string) string {
+	return filepath.Join(dir, profilesDirName, name)
+}
+
+func validateProfileName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("invalid profile name '%s'", name)
+	}
+	if strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid profile name '%s'", name)
+	}
+	return nil
+}
+
+func listProfiles(dir string) []string {
+	entries, err := os.ReadDir(filepath.Join(dir, profilesDirName))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && validateProfileName(e.Name()) == nil {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func profileExists(dir string, name string) bool {
+	return FileExists(profilePath(dir, name))
+}
+
+func readProfile(dir string, name string) (map[string]Selection, error) {
+	if err := validateProfileName(name); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(profilePath(dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("profile '%s' doesn't exist", name)
+		}
+		return nil, err
+	}
+	return parseSelectionFile(data), nil
+}
+
+func readProfileSettings(dir string, name string) (map[string]string, error) {
+	if err := validateProfileName(name); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(profilePath(dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("profile '%s' doesn't exist", name)
+		}
+		return nil, err
+	}
+	return parseSelectionSettings(data), nil
+}
+
+func writeProfile(dir string, name string, settings map[string]string, m map[string]Selection) error {
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, profilesDirName), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(profilePath(dir, name), formatSelectionFile(settings, selectionList(m)), 0644)
+}
+
+func deleteProfile(dir string, name string) error {
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+	if !profileExists(dir, name) {
+		return fmt.Errorf("profile '%s' doesn't exist", name)
+	}
+	return os.Remove(profilePath(dir, name))
+}
+
+// diffSelections lists the differences between two selections, sorted by
+// path: "-" only in a, "+" only in b and "~" selected in both but with
+// different ranges, outline, symbols or priority.
+func diffSelections(a, b map[string]Selection) []string {
+	paths := make(map[string]bool)
+	for p := range a {
+		paths[p] = true
+	}
+	for p := range b {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	var lines []string
+	for _, p := range sorted {
+		selA, inA := a[p]
+		selB, inB := b[p]
+		entryA := strings.ReplaceAll(selA.entryLine(), "\t", " ")
+		entryB := strings.ReplaceAll(selB.entryLine(), "\t", " ")
+		switch {
+		case inA && !inB:
+			lines = append(lines, "- "+entryA)
+		case !inA && inB:
+			lines = append(lines, "+ "+entryB)
+		case entryA != entryB:
+			lines = append(lines, fmt.Sprintf("~ %s -> %s", entryA, entryB))
+		}
+	}
+	return lines
+}
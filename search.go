@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/sahilm/fuzzy"
+)
+
+// searchFiles fuzzy matches query against the paths of the files below
+// root, relative to it. It returns the matches in tree order and the best
+// one.
+func searchFiles(root *FileNode, query string, showIgnored bool) (map[*FileNode]bool, *FileNode) {
+	var nodes []*FileNode
+	var paths []string
+	var traverse func(n *FileNode)
+	traverse = func(n *FileNode) {
+		if n.Ignored && !showIgnored {
+			return
+		}
+		if !n.IsDir {
+			if rel, err := filepath.Rel(root.Path, n.Path); err == nil {
+				nodes = append(nodes, n)
+				paths = append(paths, filepath.ToSlash(rel))
+			}
+		}
+		for _, child := range n.Children {
+			traverse(child)
+		}
+	}
+	traverse(root)
+
+	matches := make(map[*FileNode]bool)
+	var best *FileNode
+	for i, match := range fuzzy.Find(query, paths) {
+		if i == 0 {
+			best = nodes[match.Index]
+		}
+		matches[nodes[match.Index]] = true
+	}
+	return matches, best
+}
+
+// flattenMatches lists the matches with their parent directories, in tree
+// order and whether the directories are expanded or not.
+func flattenMatches(root *FileNode, matches map[*FileNode]bool) []*FileNode {
+	include := make(map[*FileNode]bool)
+	for node := range matches {
+		for n := node; n != nil && n != root; n = n.Parent {
+			include[n] = true
+		}
+	}
+
+	var result []*FileNode
+	var traverse func(n *FileNode)
+	traverse = func(n *FileNode) {
+		for _, child := range n.Children {
+			if include[child] {
+				result = append(result, child)
+				traverse(child)
+			}
+		}
+	}
+	traverse(root)
+	return result
+}
+
+// refreshVisible rebuilds the visible nodes, filtered by the search while
+// there is one and down to the selection in the selected only view.
+func (m model) refreshVisible() model {
+	switch {
+	case m.searchQuery != "":
+		m.visibleNodes = flattenMatches(m.root, m.searchMatches)
+		if m.selectedMode {
+			m.visibleNodes = slices.DeleteFunc(m.visibleNodes, func(n *FileNode) bool {
+				return !n.Selected && !n.SomeSelected
+			})
+		}
+	case m.selectedMode:
+		m.visibleNodes = flattenSelected(m.root)
+	default:
+		m.visibleNodes = flattenVisible(m.root, m.showIgnored)
+	}
+	m.cursor = min(m.cursor, max(len(m.visibleNodes)-1, 0))
+	return m
+}
+
+// scrollToCursor moves the viewport so the cursor is in view.
+func (m model) scrollToCursor() model {
+	m.viewport.SetContent(m.renderContent())
+	if m.cursor < m.viewport.YOffset {
+		m.viewport.SetYOffset(m.cursor)
+	} else if m.cursor >= m.viewport.YOffset+m.viewport.Height {
+		m.viewport.SetYOffset(m.cursor - m.viewport.Height + 1)
+	}
+	return m
+}
+
+func (m model) openSearch() model {
+	previous := m.searchQuery
+	m = m.openPrompt("/", func(m model, query string) model {
+		return m.updateSearch(query)
+	}, model.searchHint)
+	m.promptInput.SetValue(previous)
+	m.promptChange = model.updateSearch
+	m.promptCancel = func(m model) model {
+		return m.updateSearch(previous)
+	}
+	return m
+}
+
+func (m model) searchHint(query string) string {
+	if query == "" {
+		return "fuzzy search"
+	}
+	return fmt.Sprintf("%d matches", len(m.searchMatches))
+}
+
+// updateSearch filters the tree down to the files matching query and puts
+// the cursor on the best match. An empty query shows the whole tree again.
+func (m model) updateSearch(query string) model {
+	m.searchQuery = query
+	if query == "" {
+		m.searchMatches = nil
+		current := m.currentNode()
+		m = m.refreshVisible()
+		m = m.cursorTo(current)
+		return m.scrollToCursor()
+	}
+
+	matches, best := searchFiles(m.root, query, m.showIgnored)
+	m.searchMatches = matches
+	m = m.refreshVisible()
+	m = m.cursorTo(best)
+	return m.scrollToCursor()
+}
+
+// cursorTo puts the cursor on node if it is visible.
+func (m model) cursorTo(node *FileNode) model {
+	for i, n := range m.visibleNodes {
+		if n == node {
+			m.cursor = i
+			break
+		}
+	}
+	return m
+}
+
+func (m model) clearSearch() model {
+	if m.searchQuery == "" {
+		return m
+	}
+	return m.updateSearch("")
+}
+
+func (m model) nextMatch() model {
+	return m.jumpMatch(1)
+}
+
+func (m model) prevMatch() model {
+	return m.jumpMatch(-1)
+}
+
+// jumpMatch moves the cursor to the next match in direction, wrapping
+// around at the ends.
+func (m model) jumpMatch(direction int) model {
+	n := len(m.visibleNodes)
+	if len(m.searchMatches) == 0 || n == 0 {
+		return m
+	}
+	for step := 1; step <= n; step++ {
+		i := ((m.cursor+direction*step)%n + n) % n
+		if m.searchMatches[m.visibleNodes[i]] {
+			m.cursor = i
+			break
+		}
+	}
+	return m.scrollToCursor()
+}
+
+// matchPosition returns which match the cursor is on, counting from 1, or 0
+// when it is not on a match.
+func (m model) matchPosition() int {
+	position := 0
+	for i, node := range m.visibleNodes {
+		if m.searchMatches[node] {
+			position++
+		}
+		if i == m.cursor {
+			if m.searchMatches[node] {
+				return position
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// selectMatches selects all files matching the search as a single action.
+func (m model) selectMatches() model {
+	if len(m.searchMatches) == 0 {
+		return m
+	}
+	var files []*FileNode
+	for _, node := range m.visibleNodes {
+		if m.searchMatches[node] && !node.IsBinary && !node.Ignored {
+			files = append(files, node)
+		}
+	}
+	m = m.selectFiles(files, true)
+	return m.showToast(fmt.Sprintf("Selected %d matches", len(files)))
+}
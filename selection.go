@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LineRange is an inclusive range of 1-based line numbers.
+type LineRange struct {
+	Start int
+	End   int
+}
+
+func (r LineRange) String() string {
+	if r.Start == r.End {
+		return strconv.Itoa(r.Start)
+	}
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+// Selection is one entry of the .punjado state: a file relative to the project
+// root, optionally narrowed down to a set of line ranges. An empty Ranges
+// slice means the whole file is selected.
+//
+// Order is the position of the entry in the stored selection, which keeps
+// the order files were added in, and 0 for an entry that is not stored yet.
+// Priority orders the copy with --sort priority, higher first. An Outline
+// file is copied as its outline, see outlineFile, instead of in full, and a
+// Go file with Symbols as just the declarations with these names, see
+// symbolsFile.
+type Selection struct {
+	Path     string
+	Ranges   []LineRange
+	Order    int
+	Priority int
+	Outline  bool
+	Symbols  []string
+}
+
+func (s Selection) state() fileState {
+	return fileState{Ranges: s.Ranges, Outline: s.Outline, Symbols: s.Symbols}
+}
+
+func (s Selection) IsPartial() bool {
+	return len(s.Ranges) > 0
+}
+
+func (s Selection) String() string {
+	if !s.IsPartial() {
+		return s.Path
+	}
+	return s.Path + ":" + formatRanges(s.Ranges)
+}
+
+// entryLine is how the selection is stored: the entry followed by its
+// attributes, separated by tabs.
+func (s Selection) entryLine() string {
+	line := s.String()
+	if s.Priority != 0 {
+		line += "\tpriority=" + strconv.Itoa(s.Priority)
+	}
+	if s.Outline {
+		line += "\toutline"
+	}
+	if len(s.Symbols) > 0 {
+		line += "\tsymbols=" + strings.Join(s.Symbols, ",")
+	}
+	return line
+}
+
+var rangeSuffix = regexp.MustCompile(`:(\d+(-\d+)?(,\d+(-\d+)?)*)$`)
+
+// parseSelectionEntry splits "path:10-80,120-140" into a Selection. A colon
+// that is not followed by a valid range list is kept as part of the path.
+func parseSelectionEntry(entry string) (Selection, error) {
+	entry = strings.TrimSpace(entry)
+	loc := rangeSuffix.FindStringSubmatchIndex(entry)
+	if loc == nil {
+		return Selection{Path: entry}, nil
+	}
+	ranges, err := parseRanges(entry[loc[2]:loc[3]])
+	if err != nil {
+		return Selection{}, err
+	}
+	return Selection{Path: entry[:loc[0]], Ranges: ranges}, nil
+}
+
+// parseSelectionLine reads a stored entry with its attributes, as written
+// by entryLine. Unknown attributes are ignored.
+func parseSelectionLine(line string) (Selection, error) {
+	fields := strings.Split(line, "\t")
+	sel, err := parseSelectionEntry(fields[0])
+	if err != nil {
+		return Selection{}, err
+	}
+	for _, attr := range fields[1:] {
+		key, value, _ := strings.Cut(strings.TrimSpace(attr), "=")
+		switch key {
+		case "priority":
+			if sel.Priority, err = strconv.Atoi(value); err != nil {
+				return Selection{}, fmt.Errorf("invalid priority '%s'", value)
+			}
+		case "outline":
+			sel.Outline = true
+		case "symbols":
+			sel.Symbols = strings.Split(value, ",")
+		}
+	}
+	return sel, nil
+}
+
+// parseSelectionFile reads the line based format shared by .punjado and the
+// saved profiles. Lines that fail to parse are skipped, as are setting lines
+// starting with "@". Entries are numbered in the order of the file.
+func parseSelectionFile(data []byte) map[string]Selection {
+	m := make(map[string]Selection)
+	for _, line := range strings.Split(string(data), "\n") {
+		if s := strings.TrimSpace(line); s != "" && s[0] != '@' {
+			sel, err := parseSelectionLine(s)
+			if err != nil {
+				continue
+			}
+			sel.Order = len(m) + 1
+			m[sel.Path] = sel
+		}
+	}
+	return m
+}
+
+func selectionMap(selected []Selection) map[string]Selection {
+	m := make(map[string]Selection, len(selected))
+	for _, sel := range selected {
+		m[sel.Path] = sel
+	}
+	return m
+}
+
+// parseSelectionSettings reads the "@key value" lines of a selection file.
+// They let a project or profile carry its own settings, like the budget.
+func parseSelectionSettings(data []byte) map[string]string {
+	settings := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		s := strings.TrimSpace(line)
+		if !strings.HasPrefix(s, "@") {
+			continue
+		}
+		key, value, _ := strings.Cut(s[1:], " ")
+		if key != "" {
+			settings[key] = strings.TrimSpace(value)
+		}
+	}
+	return settings
+}
+
+func formatSelectionFile(settings map[string]string, selected []Selection) []byte {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var lines []string
+	for _, key := range keys {
+		lines = append(lines, "@"+key+" "+settings[key])
+	}
+	for _, sel := range selected {
+		lines = append(lines, sel.entryLine())
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// selectionList returns the entries in their stored order. Entries that are
+// not stored yet come last, by path.
+func selectionList(m map[string]Selection) []Selection {
+	selected := make([]Selection, 0, len(m))
+	for _, sel := range m {
+		selected = append(selected, sel)
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		a, b := selected[i], selected[j]
+		if (a.Order == 0) != (b.Order == 0) {
+			return b.Order == 0
+		}
+		if a.Order != b.Order {
+			return a.Order < b.Order
+		}
+		return a.Path < b.Path
+	})
+	return selected
+}
+
+// putSelection adds sel to m after the entries already there. An entry that
+// is replaced keeps its place and, unless sel sets one, its priority.
+func putSelection(m map[string]Selection, sel Selection) {
+	if existing, ok := m[sel.Path]; ok {
+		sel.Order = existing.Order
+		if sel.Priority == 0 {
+			sel.Priority = existing.Priority
+		}
+	} else {
+		sel.Order = 1
+		for _, other := range m {
+			sel.Order = max(sel.Order, other.Order+1)
+		}
+	}
+	m[sel.Path] = sel
+}
+
+// keepOrder gives the entries of selected without a place the place and
+// priority they have in prev, and appends the new ones in the order of
+// selected.
+func keepOrder(prev map[string]Selection, selected []Selection) map[string]Selection {
+	m := make(map[string]Selection, len(selected))
+	for _, sel := range selected {
+		if sel.Order != 0 {
+			m[sel.Path] = sel
+		} else if p, ok := prev[sel.Path]; ok {
+			sel.Order, sel.Priority = p.Order, p.Priority
+			m[sel.Path] = sel
+		}
+	}
+	for _, sel := range selected {
+		if _, ok := m[sel.Path]; !ok {
+			putSelection(m, sel)
+		}
+	}
+	return m
+}
+
+// selectionSorts are the orders punjado copy and list accept with --sort.
+var selectionSorts = []string{"insertion", "path", "deps", "priority"}
+
+// sortSelection puts the entries of m, relative to dir, in the given order:
+// the order they were added in, by path, dependencies before the files that
+// import them, or by priority.
+func sortSelection(dir string, m map[string]Selection, mode string) ([]Selection, error) {
+	selected := selectionList(m)
+	switch mode {
+	case "insertion", "":
+	case "path":
+		sort.SliceStable(selected, func(i, j int) bool { return selected[i].Path < selected[j].Path })
+	case "priority":
+		sort.SliceStable(selected, func(i, j int) bool { return selected[i].Priority > selected[j].Priority })
+	case "deps":
+		selected = sortByDeps(dir, selected)
+	default:
+		return nil, fmt.Errorf("unknown sort '%s' (use %s)", mode, strings.Join(selectionSorts, ", "))
+	}
+	return selected, nil
+}
+
+func parseRanges(s string) ([]LineRange, error) {
+	var ranges []LineRange
+	for _, part := range strings.Split(s, ",") {
+		startStr, endStr, found := strings.Cut(part, "-")
+		start, err := strconv.Atoi(startStr)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if found {
+			end, err = strconv.Atoi(endStr)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if start < 1 || end < start {
+			return nil, fmt.Errorf("invalid line range '%s'", part)
+		}
+		ranges = append(ranges, LineRange{Start: start, End: end})
+	}
+	return normalizeRanges(ranges), nil
+}
+
+func formatRanges(ranges []LineRange) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// normalizeRanges sorts the ranges and merges the ones that overlap or touch.
+func normalizeRanges(ranges []LineRange) []LineRange {
+	if len(ranges) == 0 {
+		return nil
+	}
+	sorted := append([]LineRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	merged := []LineRange{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End+1 {
+			last.End = max(last.End, r.End)
+		} else {
+			merged = append(merged, r)
+		}
+	}
+	return merged
+}
+
+// fileLines splits content into its lines, each with its newline.
+func fileLines(content []byte) []string {
+	lines := strings.SplitAfter(string(content), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// extractRange returns the lines of content covered by r, clamped to the
+// length of the file. The second value is the last line actually included,
+// which is before r.Start when the range starts past the end of the file.
+func extractRange(content []byte, r LineRange) (string, int) {
+	lines := fileLines(content)
+	if r.Start > len(lines) {
+		return "", len(lines)
+	}
+	end := min(r.End, len(lines))
+	return strings.Join(lines[r.Start-1:end], ""), end
+}
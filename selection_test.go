@@ -0,0 +1,191 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRanges(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []LineRange
+		wantErr bool
+	}{
+		{in: "10", want: []LineRange{{10, 10}}},
+		{in: "10-20", want: []LineRange{{10, 20}}},
+		{in: "10-20,5-8", want: []LineRange{{5, 8}, {10, 20}}},
+		{in: "1-3,4-6", want: []LineRange{{1, 6}}},
+		{in: "1-5,3-4", want: []LineRange{{1, 5}}},
+		{in: "1-5,2-9,20", want: []LineRange{{1, 9}, {20, 20}}},
+		{in: "0", wantErr: true},
+		{in: "5-3", wantErr: true},
+		{in: "a", wantErr: true},
+		{in: "1-", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseRanges(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRanges(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRanges(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeRanges(t *testing.T) {
+	tests := []struct {
+		in   []LineRange
+		want []LineRange
+	}{
+		{nil, nil},
+		{[]LineRange{{5, 6}}, []LineRange{{5, 6}}},
+		{[]LineRange{{8, 9}, {1, 2}}, []LineRange{{1, 2}, {8, 9}}},
+		{[]LineRange{{1, 2}, {3, 4}}, []LineRange{{1, 4}}},
+		{[]LineRange{{1, 10}, {2, 3}}, []LineRange{{1, 10}}},
+		{[]LineRange{{4, 6}, {1, 5}, {20, 20}}, []LineRange{{1, 6}, {20, 20}}},
+	}
+	for _, tt := range tests {
+		if got := normalizeRanges(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("normalizeRanges(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseSelectionEntry(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Selection
+		wantErr bool
+	}{
+		{in: "main.go", want: Selection{Path: "main.go"}},
+		{in: " main.go ", want: Selection{Path: "main.go"}},
+		{in: "main.go:10-20", want: Selection{Path: "main.go", Ranges: []LineRange{{10, 20}}}},
+		{in: "main.go:30,1-2", want: Selection{Path: "main.go", Ranges: []LineRange{{1, 2}, {30, 30}}}},
+		{in: "dir:with:colons.go", want: Selection{Path: "dir:with:colons.go"}},
+		{in: "odd:name:3", want: Selection{Path: "odd:name", Ranges: []LineRange{{3, 3}}}},
+		{in: "main.go:", want: Selection{Path: "main.go:"}},
+		{in: "main.go:0", wantErr: true},
+		{in: "main.go:9-2", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSelectionEntry(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSelectionEntry(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSelectionEntry(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSelectionLineRoundTrip(t *testing.T) {
+	tests := []struct {
+		sel  Selection
+		line string
+	}{
+		{Selection{Path: "a.go"}, "a.go"},
+		{Selection{Path: "a.go", Ranges: []LineRange{{1, 4}, {9, 9}}}, "a.go:1-4,9"},
+		{Selection{Path: "a.go", Priority: 5}, "a.go\tpriority=5"},
+		{Selection{Path: "a.go", Priority: -2}, "a.go\tpriority=-2"},
+		{Selection{Path: "a.go", Outline: true}, "a.go\toutline"},
+		{Selection{Path: "a.go", Symbols: []string{"Foo", "T.Bar", "init#2"}}, "a.go\tsymbols=Foo,T.Bar,init#2"},
+		{
+			Selection{Path: "dir/b c.go", Priority: 1, Symbols: []string{"_", "_#2"}},
+			"dir/b c.go\tpriority=1\tsymbols=_,_#2",
+		},
+		{
+			Selection{Path: "x.py", Ranges: []LineRange{{3, 7}}, Priority: 2},
+			"x.py:3-7\tpriority=2",
+		},
+	}
+	for _, tt := range tests {
+		line := tt.sel.entryLine()
+		if line != tt.line {
+			t.Errorf("entryLine(%+v) = %q, want %q", tt.sel, line, tt.line)
+		}
+		got, err := parseSelectionLine(line)
+		if err != nil {
+			t.Errorf("parseSelectionLine(%q) error: %v", line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.sel) {
+			t.Errorf("parseSelectionLine(%q) = %+v, want %+v", line, got, tt.sel)
+		}
+	}
+}
+
+func TestParseSelectionLine(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Selection
+		wantErr bool
+	}{
+		{in: "a.go\tunknown=1", want: Selection{Path: "a.go"}},
+		{in: "a.go\t outline ", want: Selection{Path: "a.go", Outline: true}},
+		{in: "a.go\tpriority=high", wantErr: true},
+		{in: "a.go:0\toutline", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSelectionLine(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSelectionLine(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSelectionLine(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSelectionFileRoundTrip(t *testing.T) {
+	data := []byte("@budget 8000\n@budget-mode hard\nb.go\n\na.go:2-3\tpriority=4\nbad.go:0\nc.go\toutline\n")
+
+	selected := parseSelectionFile(data)
+	want := map[string]Selection{
+		"b.go": {Path: "b.go", Order: 1},
+		"a.go": {Path: "a.go", Ranges: []LineRange{{2, 3}}, Priority: 4, Order: 2},
+		"c.go": {Path: "c.go", Outline: true, Order: 3},
+	}
+	if !reflect.DeepEqual(selected, want) {
+		t.Errorf("parseSelectionFile = %+v, want %+v", selected, want)
+	}
+	settings := parseSelectionSettings(data)
+	wantSettings := map[string]string{"budget": "8000", "budget-mode": "hard"}
+	if !reflect.DeepEqual(settings, wantSettings) {
+		t.Errorf("parseSelectionSettings = %v, want %v", settings, wantSettings)
+	}
+
+	formatted := string(formatSelectionFile(settings, selectionList(selected)))
+	wantFormatted := "@budget 8000\n@budget-mode hard\nb.go\na.go:2-3\tpriority=4\nc.go\toutline"
+	if formatted != wantFormatted {
+		t.Errorf("formatSelectionFile = %q, want %q", formatted, wantFormatted)
+	}
+}
+
+func TestExtractRange(t *testing.T) {
+	content := []byte("one\ntwo\nthree\n")
+	tests := []struct {
+		r       LineRange
+		want    string
+		wantEnd int
+	}{
+		{LineRange{1, 1}, "one\n", 1},
+		{LineRange{2, 3}, "two\nthree\n", 3},
+		{LineRange{2, 50}, "two\nthree\n", 3},
+		{LineRange{4, 6}, "", 3},
+	}
+	for _, tt := range tests {
+		got, end := extractRange(content, tt.r)
+		if got != tt.want || end != tt.wantEnd {
+			t.Errorf("extractRange(%v) = %q, %d, want %q, %d", tt.r, got, end, tt.want, tt.wantEnd)
+		}
+	}
+
+	if got, end := extractRange([]byte("no newline"), LineRange{1, 2}); got != "no newline" || end != 1 {
+		t.Errorf("extractRange without a final newline = %q, %d", got, end)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// nodeStats sums up a node of the tree. For a directory Size and Tokens
+// count every file below it that is not ignored, Selected the tokens of the
+// selected ones and ModTime is that of the newest file.
+type nodeStats struct {
+	Size     int64
+	Tokens   int
+	Selected int
+	ModTime  time.Time
+}
+
+// estimateTokens guesses the tokens of a file from its size, at about four
+// bytes a token, so the tree does not have to read every file.
+func estimateTokens(n *FileNode) int {
+	if n.IsDir || n.IsBinary {
+		return 0
+	}
+	return int(n.Size / 4)
+}
+
+// treeStats computes the stats of every node below the root. Selected files
+// are counted exactly, the others and the symbols of Go files are
+// estimated.
+func (m model) treeStats() map[*FileNode]nodeStats {
+	stats := make(map[*FileNode]nodeStats)
+	var traverse func(n *FileNode) nodeStats
+	traverse = func(n *FileNode) nodeStats {
+		s := nodeStats{ModTime: n.ModTime}
+		if !n.IsDir {
+			s.Size = n.Size
+			s.Tokens = estimateTokens(n)
+			if n.Selected {
+				if tokens, err := m.tokens.CountFile(n.Path, nil); err == nil {
+					s.Tokens = tokens
+				}
+				if tokens, err := m.tokens.CountSelected(n.Path, n.state()); err == nil {
+					s.Selected = tokens
+				}
+			}
+			for _, decl := range n.Decls {
+				d := nodeStats{Size: decl.Size, Tokens: estimateTokens(decl), ModTime: decl.ModTime}
+				if decl.symbolSelected() {
+					d.Selected = d.Tokens
+				}
+				stats[decl] = d
+			}
+		}
+		for _, child := range n.Children {
+			c := traverse(child)
+			if child.Ignored && !n.Ignored {
+				continue
+			}
+			s.Size += c.Size
+			s.Tokens += c.Tokens
+			s.Selected += c.Selected
+			if c.ModTime.After(s.ModTime) {
+				s.ModTime = c.ModTime
+			}
+		}
+		stats[n] = s
+		return s
+	}
+	traverse(m.root)
+	return stats
+}
+
+// annotation is the size and tokens shown right of a node. A file shows its
+// exact tokens once selected and an estimate marked with ~ before, a
+// directory its selected tokens against its total.
+func annotation(n *FileNode, s nodeStats) string {
+	tokens := "~" + formatTokenCount(s.Tokens)
+	switch {
+	case n.IsDir:
+		tokens = formatTokenCount(s.Selected) + "/" + formatTokenCount(s.Tokens)
+	case n.IsBinary:
+		tokens = "-"
+	case n.Selected:
+		tokens = formatTokenCount(s.Selected)
+	}
+	return fmt.Sprintf("%9s %11s", formatSize(s.Size), tokens)
+}
+
+// sortTree sorts the children of every directory below root by name, size,
+// tokens or mtime. Name is the order the tree is read in, the others put the
+// largest and newest first.
+func sortTree(root *FileNode, mode string, stats map[*FileNode]nodeStats) {
+	compare := func(a, b *FileNode) int {
+		switch mode {
+		case "size":
+			return cmp.Compare(stats[b].Size, stats[a].Size)
+		case "tokens":
+			return cmp.Compare(stats[b].Tokens, stats[a].Tokens)
+		case "mtime":
+			return stats[b].ModTime.Compare(stats[a].ModTime)
+		}
+		return 0
+	}
+	var traverse func(n *FileNode)
+	traverse = func(n *FileNode) {
+		slices.SortStableFunc(n.Children, func(a, b *FileNode) int {
+			if c := compare(a, b); c != 0 {
+				return c
+			}
+			return strings.Compare(a.Name, b.Name)
+		})
+		for _, child := range n.Children {
+			traverse(child)
+		}
+	}
+	traverse(root)
+}
+
+func (m model) sortByName() model {
+	return m.sortTreeBy("name")
+}
+
+func (m model) sortBySize() model {
+	return m.sortTreeBy("size")
+}
+
+func (m model) sortByTokens() model {
+	return m.sortTreeBy("tokens")
+}
+
+func (m model) sortByMtime() model {
+	return m.sortTreeBy("mtime")
+}
+
+// sortTreeBy sorts the tree by mode, keeping the cursor on the same node.
+func (m model) sortTreeBy(mode string) model {
+	current := m.currentNode()
+	sortTree(m.root, mode, m.treeStats())
+	m = m.refreshVisible()
+	m = m.cursorTo(current)
+	m = m.scrollToCursor()
+	return m.showToast("Sorted by " + mode)
+}
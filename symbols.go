@@ -0,0 +1,222 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// goSymbol is a top-level declaration of a Go file. Name is how it is
+// stored in the selection: the name of a func, type, const or var, and
+// Type.Method for a method, so it is found again after the file changes.
+// A grouped declaration is named after its first name. Names that repeat,
+// like init or _, get the number of the occurrence from the second one on,
+// as in init#2. Label is how it is shown in the tree and Text its source
+// with the doc comment.
+type goSymbol struct {
+	Name  string
+	Label string
+	Text  string
+	decl  ast.Decl
+}
+
+// parsedGoFile is a Go file parsed for its symbols.
+type parsedGoFile struct {
+	fset    *token.FileSet
+	file    *ast.File
+	content []byte
+	symbols []goSymbol
+}
+
+func parseGoSymbols(content []byte) (*parsedGoFile, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	p := &parsedGoFile{fset: fset, file: file, content: content}
+	seen := make(map[string]int)
+	for _, decl := range file.Decls {
+		start := decl.Pos()
+		var sym goSymbol
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT || len(d.Specs) == 0 {
+				continue
+			}
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+			names := specNames(d.Specs)
+			sym.Name = names[0]
+			sym.Label = d.Tok.String() + " " + names[0]
+			if len(names) > 1 {
+				sym.Label = d.Tok.String() + " (" + strings.Join(names, ", ") + ")"
+			}
+		case *ast.FuncDecl:
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+			sym.Name = d.Name.Name
+			sym.Label = "func " + d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				recv, pointer := receiverType(d.Recv.List[0].Type)
+				sym.Name = recv + "." + d.Name.Name
+				if pointer {
+					recv = "*" + recv
+				}
+				sym.Label = "func (" + recv + ") " + d.Name.Name
+			}
+		}
+		seen[sym.Name]++
+		if n := seen[sym.Name]; n > 1 {
+			sym.Name += "#" + strconv.Itoa(n)
+			sym.Label += " #" + strconv.Itoa(n)
+		}
+		sym.Text = p.source(start, decl.End())
+		sym.decl = decl
+		p.symbols = append(p.symbols, sym)
+	}
+	return p, nil
+}
+
+func (p *parsedGoFile) source(from, to token.Pos) string {
+	return string(p.content[p.fset.Position(from).Offset:p.fset.Position(to).Offset])
+}
+
+// specNames returns the names a declaration declares, in order.
+func specNames(specs []ast.Spec) []string {
+	var names []string
+	for _, spec := range specs {
+		switch s := spec.(type) {
+		case *ast.TypeSpec:
+			names = append(names, s.Name.Name)
+		case *ast.ValueSpec:
+			for _, name := range s.Names {
+				names = append(names, name.Name)
+			}
+		}
+	}
+	return names
+}
+
+// receiverType returns the name of the type of a method receiver and
+// whether it is a pointer. Type parameters are left out.
+func receiverType(expr ast.Expr) (string, bool) {
+	pointer := false
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr, pointer = star.X, true
+	}
+	switch t := expr.(type) {
+	case *ast.IndexExpr:
+		expr = t.X
+	case *ast.IndexListExpr:
+		expr = t.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name, pointer
+	}
+	return "", pointer
+}
+
+// goSymbols lists the top-level declarations of a Go file.
+func goSymbols(content []byte) ([]goSymbol, error) {
+	p, err := parseGoSymbols(content)
+	if err != nil {
+		return nil, err
+	}
+	return p.symbols, nil
+}
+
+// symbolsFile reduces a Go file to the declarations with the given names,
+// in the order of the file, with the package clause and the imports they
+// use. Names that are not declared in the file any more are skipped.
+func symbolsFile(content []byte, names []string) (string, error) {
+	p, err := parseGoSymbols(content)
+	if err != nil {
+		return "", err
+	}
+
+	used := make(map[string]bool)
+	var decls []string
+	for _, sym := range p.symbols {
+		if !slices.Contains(names, sym.Name) {
+			continue
+		}
+		decls = append(decls, sym.Text)
+		ast.Inspect(sym.decl, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if ident, ok := sel.X.(*ast.Ident); ok {
+					used[ident.Name] = true
+				}
+			}
+			return true
+		})
+	}
+
+	var imports []string
+	for _, spec := range p.file.Imports {
+		name := importName(spec)
+		if name == "." || used[name] {
+			imports = append(imports, p.source(spec.Pos(), spec.End()))
+		}
+	}
+
+	parts := []string{"package " + p.file.Name.Name}
+	switch len(imports) {
+	case 0:
+	case 1:
+		parts = append(parts, "import "+imports[0])
+	default:
+		parts = append(parts, "import (\n\t"+strings.Join(imports, "\n\t")+"\n)")
+	}
+	parts = append(parts, decls...)
+	return strings.Join(parts, "\n\n") + "\n", nil
+}
+
+// missingSymbols returns the names the Go file at path does not declare.
+func missingSymbols(path string, names []string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	symbols, err := goSymbols(content)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, name := range names {
+		if !slices.ContainsFunc(symbols, func(sym goSymbol) bool { return sym.Name == name }) {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// importName is the name an import is used by in the file. Without an
+// explicit name it is guessed from the path, the way most packages are
+// named: the last element without a major version, a go- prefix or a
+// suffix after a dot or dash, as in gopkg.in/yaml.v3 or go-isatty.
+func importName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	importPath := strings.Trim(spec.Path.Value, "`\"")
+	name := path.Base(importPath)
+	if majorVersion.MatchString(name) && path.Dir(importPath) != "." {
+		name = path.Base(path.Dir(importPath))
+	}
+	name = strings.TrimPrefix(name, "go-")
+	if i := strings.IndexAny(name, ".-"); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
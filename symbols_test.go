@@ -0,0 +1,175 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const symbolsSource = `package shapes
+
+import (
+	"fmt"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+	"github.com/mattn/go-isatty"
+)
+
+// Shape is anything with an area.
+type Shape interface{ Area() float64 }
+
+const (
+	Pi = 3.14
+	E  = 2.71
+)
+
+var _ = fmt.Sprint
+
+func init() { fmt.Println("one") }
+
+// Square is a shape.
+type Square struct{ Side float64 }
+
+// Area returns the area.
+func (s *Square) Area() float64 { return s.Side * s.Side }
+
+func (s Square) String() string { return strings.Repeat("#", int(s.Side)) }
+
+func init() { _ = yaml.Marshal }
+
+var _ = isatty.IsTerminal
+
+type List[T any] []T
+
+func (l List[T]) Len() int { return len(l) }
+`
+
+func TestGoSymbols(t *testing.T) {
+	symbols, err := goSymbols([]byte(symbolsSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ name, label string }{
+		{"Shape", "type Shape"},
+		{"Pi", "const (Pi, E)"},
+		{"_", "var _"},
+		{"init", "func init"},
+		{"Square", "type Square"},
+		{"Square.Area", "func (*Square) Area"},
+		{"Square.String", "func (Square) String"},
+		{"init#2", "func init #2"},
+		{"_#2", "var _ #2"},
+		{"List", "type List"},
+		{"List.Len", "func (List) Len"},
+	}
+	if len(symbols) != len(want) {
+		t.Fatalf("got %d symbols, want %d", len(symbols), len(want))
+	}
+	for i, sym := range symbols {
+		if sym.Name != want[i].name || sym.Label != want[i].label {
+			t.Errorf("symbol %d = %q %q, want %q %q", i, sym.Name, sym.Label, want[i].name, want[i].label)
+		}
+	}
+	if got := symbols[0].Text; got != "// Shape is anything with an area.\ntype Shape interface{ Area() float64 }" {
+		t.Errorf("Shape text = %q", got)
+	}
+
+	if _, err := goSymbols([]byte("package a\nfunc {")); err == nil {
+		t.Error("goSymbols of a broken file succeeded")
+	}
+}
+
+func TestSymbolsFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		want  string
+	}{
+		{
+			name:  "declaration with its import",
+			names: []string{"Square.String"},
+			want: "package shapes\n\nimport \"strings\"\n\n" +
+				"func (s Square) String() string { return strings.Repeat(\"#\", int(s.Side)) }\n",
+		},
+		{
+			name:  "file order and no imports",
+			names: []string{"Square.Area", "Shape"},
+			want: "package shapes\n\n" +
+				"// Shape is anything with an area.\ntype Shape interface{ Area() float64 }\n\n" +
+				"// Area returns the area.\nfunc (s *Square) Area() float64 { return s.Side * s.Side }\n",
+		},
+		{
+			name:  "repeated names are told apart",
+			names: []string{"init#2", "_#2"},
+			want: "package shapes\n\nimport (\n\tyaml \"gopkg.in/yaml.v3\"\n\t\"github.com/mattn/go-isatty\"\n)\n\n" +
+				"func init() { _ = yaml.Marshal }\n\nvar _ = isatty.IsTerminal\n",
+		},
+		{
+			name:  "first of the repeated names",
+			names: []string{"init"},
+			want:  "package shapes\n\nimport \"fmt\"\n\nfunc init() { fmt.Println(\"one\") }\n",
+		},
+		{
+			name:  "missing names are skipped",
+			names: []string{"Gone", "init#3"},
+			want:  "package shapes\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := symbolsFile([]byte(symbolsSource), tt.names)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("symbolsFile = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingSymbols(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"shapes.go": symbolsSource})
+
+	missing, err := missingSymbols(filepath.Join(dir, "shapes.go"), []string{"Shape", "init#2", "init#3", "Area", "Square.Area"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"init#3", "Area"}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("missingSymbols = %q, want %q", missing, want)
+	}
+	if _, err := missingSymbols(filepath.Join(dir, "none.go"), []string{"A"}); err == nil {
+		t.Error("missingSymbols of a missing file succeeded")
+	}
+}
+
+func TestImportName(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{`"fmt"`, "fmt"},
+		{`"net/http"`, "http"},
+		{`y "gopkg.in/yaml.v3"`, "y"},
+		{`"gopkg.in/yaml.v3"`, "yaml"},
+		{`"github.com/mattn/go-isatty"`, "isatty"},
+		{`"github.com/charmbracelet/bubbletea/v2"`, "bubbletea"},
+		{`"github.com/google/go-cmp/cmp"`, "cmp"},
+		{`"v2"`, "v2"},
+		{`. "strings"`, "."},
+		{`_ "embed"`, "_"},
+	}
+	for _, tt := range tests {
+		file, err := parser.ParseFile(token.NewFileSet(), "", "package a\nimport "+tt.spec+"\n", parser.ImportsOnly)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := importName(file.Imports[0]); got != tt.want {
+			t.Errorf("importName(%s) = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
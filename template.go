@@ -0,0 +1,209 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateData is what a user template given with --template or the
+// output.template setting is executed with.
+type templateData struct {
+	Project     templateProject
+	Files       []templateFile
+	Commits     string
+	Tree        string
+	TotalTokens int
+
+	dir         string
+	projectTree string
+	cfg         *Config
+}
+
+// ProjectTree is the tree of the whole project with the selected files
+// marked. It is only built when a template uses it.
+func (d templateData) ProjectTree() (string, error) {
+	if d.projectTree != "" {
+		return d.projectTree, nil
+	}
+	root, err := buildFileTree(d.dir)
+	if err != nil {
+		return "", err
+	}
+	selected := make(map[string]Selection, len(d.Files))
+	for _, f := range d.Files {
+		selected[f.Path] = Selection{Path: f.Path, Ranges: f.Ranges}
+	}
+	applySelection(root, d.dir, selected)
+	opts, err := treeOptionsFromConfig(d.cfg)
+	if err != nil {
+		return "", err
+	}
+	return renderProjectTree(root, opts), nil
+}
+
+type templateProject struct {
+	Name   string
+	Root   string
+	Branch string
+	Commit string
+	Date   string
+}
+
+type templateFile struct {
+	Path      string
+	Content   string
+	Language  string
+	Tokens    int
+	Ranges    []LineRange
+	Diff      bool
+	Outline   bool
+	Symbols   []string
+	GitStatus string
+	Error     string
+}
+
+// resolveTemplatePath finds the template file: ~ is the home directory and a
+// relative path that does not exist from the working directory is looked up
+// in the project.
+func resolveTemplatePath(dir string, path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	if filepath.IsAbs(path) || FileExists(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func renderTemplate(path string, dir string, files []contextFile, commits string, tree string, cfg *Config) (string, error) {
+	path = resolveTemplatePath(dir, path)
+	funcs := template.FuncMap{
+		"fence":  markdownFence,
+		"ranges": formatRanges,
+		"join":   strings.Join,
+		"trim":   strings.TrimSpace,
+		"upper":  strings.ToUpper,
+		"lower":  strings.ToLower,
+		"indent": func(n int, s string) string {
+			pad := strings.Repeat(" ", n)
+			return pad + strings.ReplaceAll(strings.TrimSuffix(s, "\n"), "\n", "\n"+pad)
+		},
+		// readFile includes another file, relative to the template, like a
+		// shared system prompt.
+		"readFile": func(name string) (string, error) {
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(filepath.Dir(path), name)
+			}
+			data, err := os.ReadFile(name)
+			return string(data), err
+		},
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(funcs).ParseFiles(path)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	data := newTemplateData(dir, files)
+	data.Commits = commits
+	data.projectTree = tree
+	data.cfg = cfg
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func newTemplateData(dir string, files []contextFile) templateData {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		root = dir
+	}
+	branch, commit := gitHead(dir)
+	data := templateData{
+		Project: templateProject{
+			Name:   filepath.Base(root),
+			Root:   root,
+			Branch: branch,
+			Commit: commit,
+			Date:   time.Now().Format("2006-01-02"),
+		},
+		dir: dir,
+	}
+
+	statuses := gitFileStatuses(dir)
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		file := templateFile{
+			Path:      f.Path,
+			Content:   f.Content(),
+			Language:  f.Language,
+			Ranges:    f.Ranges,
+			Diff:      f.Diff,
+			Outline:   f.Outline,
+			Symbols:   f.Symbols,
+			GitStatus: statuses[filepath.ToSlash(f.Path)],
+		}
+		if f.Err != nil {
+			file.Error = f.Err.Error()
+		}
+		file.Tokens = defaultTokenizer().Count(file.Content)
+		data.TotalTokens += file.Tokens
+		data.Files = append(data.Files, file)
+		paths = append(paths, f.Path)
+	}
+	data.Tree = pathTree(paths)
+	return data
+}
+
+// pathTree draws the given relative paths as an ASCII tree, for the Tree of
+// templates.
+func pathTree(paths []string) string {
+	type treeNode struct {
+		name     string
+		children map[string]*treeNode
+	}
+	root := &treeNode{children: make(map[string]*treeNode)}
+	for _, p := range paths {
+		node := root
+		for _, part := range strings.Split(filepath.ToSlash(p), "/") {
+			child, ok := node.children[part]
+			if !ok {
+				child = &treeNode{name: part, children: make(map[string]*treeNode)}
+				node.children[part] = child
+			}
+			node = child
+		}
+	}
+
+	var sb strings.Builder
+	var draw func(n *treeNode, prefix string)
+	draw = func(n *treeNode, prefix string) {
+		names := make([]string, 0, len(n.children))
+		for name := range n.children {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i, name := range names {
+			child := n.children[name]
+			branch, next := "├── ", "│   "
+			if i == len(names)-1 {
+				branch, next = "└── ", "    "
+			}
+			label := name
+			if len(child.children) > 0 {
+				label += "/"
+			}
+			sb.WriteString(prefix + branch + label + "\n")
+			draw(child, prefix+next)
+		}
+	}
+	draw(root, "")
+	return sb.String()
+}
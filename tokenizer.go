@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/base64"
+	"strconv"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// cl100k_base.tiktoken is the BPE vocabulary used by the GPT-4 family of
+// models, one base64 encoded token and its rank per line.
+//
+//go:embed assets/cl100k_base.tiktoken
+var cl100kVocab []byte
+
+type Tokenizer struct {
+	ranks map[string]int
+}
+
+var defaultTokenizer = sync.OnceValue(func() *Tokenizer {
+	return newTokenizer(cl100kVocab)
+})
+
+func newTokenizer(vocab []byte) *Tokenizer {
+	t := &Tokenizer{ranks: make(map[string]int, 100256)}
+	for _, line := range bytes.Split(vocab, []byte("\n")) {
+		encoded, rankStr, found := bytes.Cut(line, []byte(" "))
+		if !found {
+			continue
+		}
+		token, err := base64.StdEncoding.DecodeString(string(encoded))
+		if err != nil {
+			continue
+		}
+		rank, err := strconv.Atoi(string(rankStr))
+		if err != nil {
+			continue
+		}
+		t.ranks[string(token)] = rank
+	}
+	return t
+}
+
+// Count returns the number of tokens text encodes to.
+func (t *Tokenizer) Count(text string) int {
+	count := 0
+	for len(text) > 0 {
+		n := nextPiece(text)
+		count += t.countPiece(text[:n])
+		text = text[n:]
+	}
+	return count
+}
+
+func (t *Tokenizer) countPiece(piece string) int {
+	if _, ok := t.ranks[piece]; ok {
+		return 1
+	}
+	return len(t.bytePairMerge(piece)) - 1
+}
+
+// bytePairMerge repeatedly joins the adjacent pair with the lowest rank until
+// no pair is in the vocabulary. It returns the boundaries of the resulting
+// tokens.
+func (t *Tokenizer) bytePairMerge(piece string) []int {
+	parts := make([]int, len(piece)+1)
+	for i := range parts {
+		parts[i] = i
+	}
+
+	for len(parts) > 2 {
+		minRank := -1
+		minIdx := -1
+		for i := 0; i < len(parts)-2; i++ {
+			rank, ok := t.ranks[piece[parts[i]:parts[i+2]]]
+			if ok && (minRank == -1 || rank < minRank) {
+				minRank = rank
+				minIdx = i
+			}
+		}
+		if minIdx == -1 {
+			break
+		}
+		parts = append(parts[:minIdx+1], parts[minIdx+2:]...)
+	}
+	return parts
+}
+
+// nextPiece returns the byte length of the next pre-tokenized piece of text.
+// It follows the cl100k split pattern:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}|
+//	 ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+func nextPiece(text string) int {
+	r, size := utf8.DecodeRuneInString(text)
+
+	if r == '\'' {
+		for _, suffix := range []string{"re", "ve", "ll", "s", "t", "m", "d"} {
+			if len(text) > len(suffix) && equalFoldASCII(text[1:1+len(suffix)], suffix) {
+				return 1 + len(suffix)
+			}
+		}
+	}
+
+	if unicode.IsLetter(r) {
+		return size + spanOf(text[size:], unicode.IsLetter)
+	}
+	if r != '\r' && r != '\n' && !unicode.IsNumber(r) {
+		next, _ := utf8.DecodeRuneInString(text[size:])
+		if size < len(text) && unicode.IsLetter(next) {
+			return size + spanOf(text[size:], unicode.IsLetter)
+		}
+	}
+
+	if unicode.IsNumber(r) {
+		n := size
+		for digits := 1; digits < 3 && n < len(text); digits++ {
+			next, nextSize := utf8.DecodeRuneInString(text[n:])
+			if !unicode.IsNumber(next) {
+				break
+			}
+			n += nextSize
+		}
+		return n
+	}
+
+	start := 0
+	if r == ' ' && size < len(text) {
+		next, _ := utf8.DecodeRuneInString(text[size:])
+		if isPunct(next) {
+			start = size
+		}
+	}
+	if first, _ := utf8.DecodeRuneInString(text[start:]); start < len(text) && isPunct(first) {
+		n := start + spanOf(text[start:], isPunct)
+		return n + spanOf(text[n:], isNewline)
+	}
+
+	// Only whitespace is left.
+	n := spanOf(text, unicode.IsSpace)
+	lastNewline := -1
+	for i := 0; i < n; {
+		c, cSize := utf8.DecodeRuneInString(text[i:])
+		if isNewline(c) {
+			lastNewline = i + cSize
+		}
+		i += cSize
+	}
+	if lastNewline != -1 {
+		return lastNewline
+	}
+	if n == len(text) {
+		return n
+	}
+	// Leave the last space for the following piece, like \s+(?!\S).
+	_, lastSize := utf8.DecodeLastRuneInString(text[:n])
+	if n-lastSize > 0 {
+		return n - lastSize
+	}
+	return n
+}
+
+func spanOf(text string, fn func(rune) bool) int {
+	n := 0
+	for n < len(text) {
+		r, size := utf8.DecodeRuneInString(text[n:])
+		if !fn(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+func isPunct(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+func isNewline(r rune) bool {
+	return r == '\r' || r == '\n'
+}
+
+func equalFoldASCII(a, b string) bool {
+	return bytes.EqualFold([]byte(a), []byte(b))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// The expected counts and pieces are those of tiktoken's cl100k_base
+// encoding.
+
+func TestTokenizerCount(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello world", 2},
+		{"tiktoken is great!", 6},
+		{"I'm sure they'll say it's fine, we've done what you'd want and they're here.", 22},
+		{"DON'T SHOUT, I'LL LEAVE", 10},
+		{"rock 'n' roll", 5},
+		{"1234567890", 4},
+		{"year 2024 and 31415926535 digits", 11},
+		{"x = 12345 + 6789", 9},
+		{"naïve café déjà vu", 6},
+		{"Größe über Straße", 5},
+		{"Привет, мир!", 7},
+		{"日本語のテキスト", 8},
+		{"مرحبا بالعالم", 10},
+		{"emoji 🎉🎉 party 👩\u200d💻", 14},
+		{"a    b", 3},
+		{"line\n\n\nnext", 3},
+		{"trailing   \n  \n\tindent", 6},
+		{"   leading", 2},
+		{"tabs\t\t\tand\r\nCRLF\r\n", 7},
+		{"end with spaces   ", 4},
+		{"!!!???...", 3},
+		{"foo(); bar[]{} <=> a->b && c || !d", 14},
+		{"path/to/file.go:42:7", 8},
+		{" ...\n\n", 1},
+		{"#include <stdio.h>\n", 5},
+		{"func main() {\n\tfmt.Println(\"hello, 世界\")\n}\n", 15},
+	}
+	for _, tt := range tests {
+		if got := defaultTokenizer().Count(tt.text); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestNextPiece(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"hello world", []string{"hello", " world"}},
+		{"tiktoken is great!", []string{"tiktoken", " is", " great", "!"}},
+		{"I'm sure they'll say it's fine, we've done what you'd want and they're here.", []string{"I", "'m", " sure", " they", "'ll", " say", " it", "'s", " fine", ",", " we", "'ve", " done", " what", " you", "'d", " want", " and", " they", "'re", " here", "."}},
+		{"DON'T SHOUT, I'LL LEAVE", []string{"DON", "'T", " SHOUT", ",", " I", "'LL", " LEAVE"}},
+		{"rock 'n' roll", []string{"rock", " '", "n", "'", " roll"}},
+		{"1234567890", []string{"123", "456", "789", "0"}},
+		{"year 2024 and 31415926535 digits", []string{"year", " ", "202", "4", " and", " ", "314", "159", "265", "35", " digits"}},
+		{"x = 12345 + 6789", []string{"x", " =", " ", "123", "45", " +", " ", "678", "9"}},
+		{"naïve café déjà vu", []string{"naïve", " café", " déjà", " vu"}},
+		{"Größe über Straße", []string{"Größe", " über", " Straße"}},
+		{"Привет, мир!", []string{"Привет", ",", " мир", "!"}},
+		{"日本語のテキスト", []string{"日本語のテキスト"}},
+		{"مرحبا بالعالم", []string{"مرحبا", " بالعالم"}},
+		{"emoji 🎉🎉 party 👩\u200d💻", []string{"emoji", " 🎉🎉", " party", " 👩\u200d💻"}},
+		{"a    b", []string{"a", "   ", " b"}},
+		{"line\n\n\nnext", []string{"line", "\n\n\n", "next"}},
+		{"trailing   \n  \n\tindent", []string{"trailing", "   \n  \n", "\tindent"}},
+		{"   leading", []string{"  ", " leading"}},
+		{"tabs\t\t\tand\r\nCRLF\r\n", []string{"tabs", "\t\t", "\tand", "\r\n", "CRLF", "\r\n"}},
+		{"end with spaces   ", []string{"end", " with", " spaces", "   "}},
+		{"!!!???...", []string{"!!!???..."}},
+		{"foo(); bar[]{} <=> a->b && c || !d", []string{"foo", "();", " bar", "[]{}", " <=>", " a", "->", "b", " &&", " c", " ||", " !", "d"}},
+		{"path/to/file.go:42:7", []string{"path", "/to", "/file", ".go", ":", "42", ":", "7"}},
+		{" ...\n\n", []string{" ...\n\n"}},
+		{"#include <stdio.h>\n", []string{"#include", " <", "stdio", ".h", ">\n"}},
+		{"func main() {\n\tfmt.Println(\"hello, 世界\")\n}\n", []string{"func", " main", "()", " {\n", "\tfmt", ".Println", "(\"", "hello", ",", " 世界", "\")\n", "}\n"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for text := tt.text; len(text) > 0; {
+			n := nextPiece(text)
+			got = append(got, text[:n])
+			text = text[n:]
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("pieces of %q = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
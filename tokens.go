@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type tokenCacheEntry struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mtime"`
+	Tokens  int   `json:"tokens"`
+}
+
+// TokenCounter counts the tokens of files and caches the result by mtime and
+// size, in memory and in the user cache directory, so unchanged files are
+// only tokenized once.
+type TokenCounter struct {
+	cachePath string
+	entries   map[string]tokenCacheEntry
+	dirty     bool
+}
+
+func NewTokenCounter() *TokenCounter {
+	c := &TokenCounter{entries: make(map[string]tokenCacheEntry)}
+	if cacheDir, err := os.UserCacheDir(); err == nil {
+		c.cachePath = filepath.Join(cacheDir, "punjado", "tokens.json")
+		if data, err := os.ReadFile(c.cachePath); err == nil {
+			json.Unmarshal(data, &c.entries)
+		}
+	}
+	return c
+}
+
+// CountFile returns the number of tokens of the file at path, or of the given
+// line ranges of it.
+func (c *TokenCounter) CountFile(path string, ranges []LineRange) (int, error) {
+	variant := ""
+	if len(ranges) > 0 {
+		variant = formatRanges(ranges)
+	}
+	return c.count(path, variant, func(content []byte) string {
+		if len(ranges) == 0 {
+			return string(content)
+		}
+		text := ""
+		for _, r := range ranges {
+			part, _ := extractRange(content, r)
+			text += part
+		}
+		return text
+	})
+}
+
+// CountOutline returns the number of tokens of the outline of the file at
+// path.
+func (c *TokenCounter) CountOutline(path string) (int, error) {
+	return c.count(path, "outline", func(content []byte) string {
+		return outlineFile(path, content)
+	})
+}
+
+// CountSymbols returns the number of tokens of the named declarations of
+// the Go file at path, as copied by symbolsFile.
+func (c *TokenCounter) CountSymbols(path string, names []string) (int, error) {
+	return c.count(path, "symbols="+strings.Join(names, ","), func(content []byte) string {
+		text, err := symbolsFile(content, names)
+		if err != nil {
+			return string(content)
+		}
+		return text
+	})
+}
+
+// CountSelected returns the number of tokens a selected file adds to the
+// context.
+func (c *TokenCounter) CountSelected(path string, state fileState) (int, error) {
+	switch {
+	case state.Outline:
+		return c.CountOutline(path)
+	case len(state.Symbols) > 0:
+		return c.CountSymbols(path, state.Symbols)
+	}
+	return c.CountFile(path, state.Ranges)
+}
+
+// count tokenizes the text of the file at path, cached under the variant.
+func (c *TokenCounter) count(path string, variant string, text func(content []byte) string) (int, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return 0, err
+	}
+
+	key := abs
+	if variant != "" {
+		key += ":" + variant
+	}
+	if entry, ok := c.entries[key]; ok && entry.Size == info.Size() && entry.ModTime == info.ModTime().UnixNano() {
+		return entry.Tokens, nil
+	}
+
+	content, err := os.ReadFile(abs)
+	if err != nil {
+		return 0, err
+	}
+	tokens := defaultTokenizer().Count(text(content))
+	c.entries[key] = tokenCacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Tokens:  tokens,
+	}
+	c.dirty = true
+	return tokens, nil
+}
+
+// Save writes the cache back to disk if anything new was counted.
+func (c *TokenCounter) Save() {
+	if !c.dirty || c.cachePath == "" {
+		return
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return
+	}
+	os.MkdirAll(filepath.Dir(c.cachePath), 0755)
+	if os.WriteFile(c.cachePath, data, 0644) == nil {
+		c.dirty = false
+	}
+}
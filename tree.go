@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// treeOptions limit the project tree put in front of the copied context.
+// Depth is the number of directory levels shown, 0 for all of them. A
+// directory with more than Collapse entries only shows its selected ones.
+type treeOptions struct {
+	Depth    int
+	Collapse int
+}
+
+func treeOptionsFromConfig(cfg *Config) (treeOptions, error) {
+	depth, err := strconv.Atoi(cfg.Get("tree.depth"))
+	if err != nil || depth < 0 {
+		return treeOptions{}, fmt.Errorf("invalid tree depth '%s'", cfg.Get("tree.depth"))
+	}
+	collapse, err := strconv.Atoi(cfg.Get("tree.collapse"))
+	if err != nil || collapse < 0 {
+		return treeOptions{}, fmt.Errorf("invalid tree collapse '%s'", cfg.Get("tree.collapse"))
+	}
+	return treeOptions{Depth: depth, Collapse: collapse}, nil
+}
+
+// contextTree renders the tree for the copied context when tree.enabled is
+// set. root must carry the current selection.
+func contextTree(root *FileNode, cfg *Config) (string, error) {
+	if cfg.Get("tree.enabled") != "true" {
+		return "", nil
+	}
+	opts, err := treeOptionsFromConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+	return renderProjectTree(root, opts), nil
+}
+
+// renderProjectTree draws root like tree(1) does, without ignored files.
+// Selected files are marked with a *, directories that are cut off by the
+// depth limit or collapsed show how many files they hold.
+func renderProjectTree(root *FileNode, opts treeOptions) string {
+	name := root.Path
+	if abs, err := filepath.Abs(root.Path); err == nil {
+		name = abs
+	}
+	var sb strings.Builder
+	sb.WriteString(filepath.Base(name) + "/\n")
+
+	var draw func(n *FileNode, prefix string, depth int)
+	draw = func(n *FileNode, prefix string, depth int) {
+		var children []*FileNode
+		for _, child := range n.Children {
+			if !child.Ignored {
+				children = append(children, child)
+			}
+		}
+
+		hidden := 0
+		if opts.Collapse > 0 && len(children) > opts.Collapse {
+			var shown []*FileNode
+			for _, child := range children {
+				if child.Selected || child.SomeSelected {
+					shown = append(shown, child)
+				} else {
+					hidden++
+				}
+			}
+			children = shown
+		}
+
+		for i, child := range children {
+			last := i == len(children)-1 && hidden == 0
+			branch, next := "├── ", "│   "
+			if last {
+				branch, next = "└── ", "    "
+			}
+
+			label := child.Name
+			if child.IsDir {
+				label += "/"
+			}
+			if child.Selected && !child.IsDir {
+				label += " *"
+			}
+			expand := child.IsDir && (opts.Depth == 0 || depth < opts.Depth)
+			if child.IsDir && !expand {
+				label += " (" + pluralFiles(countTreeFiles(child)) + ")"
+			}
+			sb.WriteString(prefix + branch + label + "\n")
+			if expand {
+				draw(child, prefix+next, depth+1)
+			}
+		}
+		if hidden > 0 {
+			sb.WriteString(fmt.Sprintf("%s└── ... %d more\n", prefix, hidden))
+		}
+	}
+	draw(root, "", 1)
+	return sb.String()
+}
+
+func pluralFiles(n int) string {
+	if n == 1 {
+		return "1 file"
+	}
+	return fmt.Sprintf("%d files", n)
+}
+
+func countTreeFiles(n *FileNode) int {
+	count := 0
+	for _, child := range n.Children {
+		if child.Ignored {
+			continue
+		}
+		if child.IsDir {
+			count += countTreeFiles(child)
+		} else {
+			count++
+		}
+	}
+	return count
+}
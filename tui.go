@@ -7,7 +7,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -59,8 +61,39 @@ var (
 	someSelectedStyle = lipgloss.NewStyle().
 				Foreground(lipgloss.Color("#ffa000")).
 				MarginRight(3)
+
+	partialFileStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("#83A598")).
+				MarginRight(3).Bold(true)
+
+	toastStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FAFAFA")).
+			Background(lipgloss.Color("#7D56F4")).
+			Padding(0, 1)
+
+	cursorColor  = lipgloss.Color("#444")
+	warningColor = lipgloss.Color("#E03A3E")
 )
 
+// applyTheme recolors the styles with the theme.* settings.
+func applyTheme(cfg *Config) {
+	color := func(key string) lipgloss.Color { return lipgloss.Color(cfg.Get(key)) }
+
+	headerStyle = headerStyle.Background(color("theme.accent")).Foreground(color("theme.text"))
+	tokenStyle = tokenStyle.Foreground(color("theme.text"))
+	keyStyle = keyStyle.Foreground(color("theme.text"))
+	textFileStyle = textFileStyle.Foreground(color("theme.text"))
+	gitignoreFileStyle = gitignoreFileStyle.Foreground(color("theme.muted"))
+	binFileStyle = binFileStyle.Foreground(color("theme.muted"))
+	emptyDirStyle = emptyDirStyle.Foreground(color("theme.muted"))
+	selectedFileStyle = selectedFileStyle.Foreground(color("theme.selected"))
+	partialFileStyle = partialFileStyle.Foreground(color("theme.partial"))
+	someSelectedStyle = someSelectedStyle.Foreground(color("theme.someSelected"))
+	toastStyle = toastStyle.Background(color("theme.accent")).Foreground(color("theme.text"))
+	cursorColor = color("theme.cursor")
+	warningColor = color("theme.warning")
+}
+
 type model struct {
 	root         *FileNode
 	visibleNodes []*FileNode
@@ -71,16 +104,63 @@ type model struct {
 	width        int
 	helpMode     bool
 	selectedMode bool
+	showIgnored  bool
+
+	profileMode   bool
+	profileNames  []string
+	profileCursor int
+
+	// The prompt reads a line of input in the footer, like a pattern to
+	// select. promptHint describes the input while it is typed.
+	promptMode   bool
+	promptLabel  string
+	promptInput  textinput.Model
+	promptSubmit func(model, string) model
+	promptHint   func(model, string) string
+	promptChange func(model, string) model
+	promptCancel func(model) model
+
+	// While searchQuery is set the tree only shows the files matching it
+	// and their directories.
+	searchQuery   string
+	searchMatches map[*FileNode]bool
+
+	// The preview shows the exact text a copy puts on the clipboard.
+	// previewOffset is where the tree was scrolled to before.
+	previewMode   bool
+	previewText   string
+	previewFiles  int
+	previewTokens int
+	previewOffset int
+
+	// toast is a short message in the footer, cleared after toastDuration.
+	toast   string
+	toastID int
+
+	// The pane previews the file under the cursor next to the tree. Keys go
+	// to the pane instead of the tree while it has the focus.
+	paneOpen    bool
+	paneFocused bool
+	pane        filePane
 
 	quitting bool
 
 	undoStack []Action
 	redoStack []Action
 
+	// history is the journal, kept in step with every save, and historyPos
+	// the entry the undo stack currently starts from.
+	history    []historyEntry
+	historyPos int
+
 	keymaps map[string]Keymap
 
 	keySeq          string
 	filteredKeymaps map[string]Keymap
+
+	config *Config
+	tokens *TokenCounter
+	budget Budget
 }
 
 type Keymap struct {
@@ -100,6 +180,29 @@ const undoCmdKey = "undo"
 const moveUpCmdKey = "moveUp"
 const moveDownCmdKey = "moveDown"
 const quitCmdKey = "quit"
+const toggleIgnoredCmdKey = "toggleIgnored"
+const openProfilesCmdKey = "openProfiles"
+const pageUpCmdKey = "pageUp"
+const pageDownCmdKey = "pageDown"
+const toggleExpandAllCmdKey = "toggleExpandAll"
+const selectPatternCmdKey = "selectPattern"
+const deselectPatternCmdKey = "deselectPattern"
+const copyContextCmdKey = "copyContext"
+const previewContextCmdKey = "previewContext"
+const togglePaneCmdKey = "togglePane"
+const focusPaneCmdKey = "focusPane"
+const searchCmdKey = "search"
+const nextMatchCmdKey = "nextMatch"
+const prevMatchCmdKey = "prevMatch"
+const selectMatchesCmdKey = "selectMatches"
+const toggleSelectedModeCmdKey = "toggleSelectedMode"
+const sortByNameCmdKey = "sortByName"
+const sortBySizeCmdKey = "sortBySize"
+const sortByTokensCmdKey = "sortByTokens"
+const sortByMtimeCmdKey = "sortByMtime"
+const selectDepsCmdKey = "selectDeps"
+const selectDependentsCmdKey = "selectDependents"
+const cycleOutlineCmdKey = "cycleOutline"
 
 var defaultKeymaps = []Keymap{
 	{keys: "j", cmdKey: moveDownCmdKey},
@@ -118,23 +221,71 @@ var defaultKeymaps = []Keymap{
 	{keys: "G", cmdKey: gotoBottomCmdKey},
 	{keys: "q", cmdKey: quitCmdKey},
 	{keys: "ZZ", cmdKey: quitCmdKey},
+	{keys: "I", cmdKey: toggleIgnoredCmdKey},
+	{keys: "P", cmdKey: openProfilesCmdKey},
+	{keys: "<ctrl+u>", cmdKey: pageUpCmdKey},
+	{keys: "<pgup>", cmdKey: pageUpCmdKey},
+	{keys: "<ctrl+d>", cmdKey: pageDownCmdKey},
+	{keys: "<pgdown>", cmdKey: pageDownCmdKey},
+	{keys: "T", cmdKey: toggleExpandAllCmdKey},
+	{keys: "+", cmdKey: selectPatternCmdKey},
+	{keys: "-", cmdKey: deselectPatternCmdKey},
+	{keys: "y", cmdKey: copyContextCmdKey},
+	{keys: "Y", cmdKey: previewContextCmdKey},
+	{keys: "p", cmdKey: togglePaneCmdKey},
+	{keys: "<tab>", cmdKey: focusPaneCmdKey},
+	{keys: "/", cmdKey: searchCmdKey},
+	{keys: "n", cmdKey: nextMatchCmdKey},
+	{keys: "N", cmdKey: prevMatchCmdKey},
+	{keys: "S", cmdKey: selectMatchesCmdKey},
+	{keys: "v", cmdKey: toggleSelectedModeCmdKey},
+	{keys: "on", cmdKey: sortByNameCmdKey},
+	{keys: "os", cmdKey: sortBySizeCmdKey},
+	{keys: "ot", cmdKey: sortByTokensCmdKey},
+	{keys: "om", cmdKey: sortByMtimeCmdKey},
+	{keys: "gd", cmdKey: selectDepsCmdKey},
+	{keys: "gD", cmdKey: selectDependentsCmdKey},
+	{keys: "O", cmdKey: cycleOutlineCmdKey},
 }
 
 type CmdFunc func(model) model
 
 var commandRegistry = map[string]CmdFunc{
-	moveDownCmdKey:        model.moveDown,
-	moveUpCmdKey:          model.moveUp,
-	undoCmdKey:            model.performUndo,
-	redoCmdKey:            model.performRedo,
-	toggleFileCmdKey:      model.toggleCurrentFile,
-	toggleAllCmdKey:       model.toggleAllFiles,
-	toggleDirectoryCmdKey: model.toggleDirectory,
-	toggleHelpCmdKey:      model.toggleHelp,
-	closeHelpCmdKey:       model.closeHelp,
-	gotoTopCmdKey:         model.gotoTop,
-	gotoBottomCmdKey:      model.gotoBottom,
-	quitCmdKey:            model.quit,
+	moveDownCmdKey:           model.moveDown,
+	moveUpCmdKey:             model.moveUp,
+	undoCmdKey:               model.performUndo,
+	redoCmdKey:               model.performRedo,
+	toggleFileCmdKey:         model.toggleCurrentFile,
+	toggleAllCmdKey:          model.toggleAllFiles,
+	toggleDirectoryCmdKey:    model.toggleDirectory,
+	toggleHelpCmdKey:         model.toggleHelp,
+	closeHelpCmdKey:          model.closeHelp,
+	gotoTopCmdKey:            model.gotoTop,
+	gotoBottomCmdKey:         model.gotoBottom,
+	quitCmdKey:               model.quit,
+	toggleIgnoredCmdKey:      model.toggleIgnored,
+	openProfilesCmdKey:       model.openProfilePicker,
+	pageUpCmdKey:             model.pageUp,
+	pageDownCmdKey:           model.pageDown,
+	toggleExpandAllCmdKey:    model.toggleExpandAll,
+	selectPatternCmdKey:      model.openSelectPattern,
+	deselectPatternCmdKey:    model.openDeselectPattern,
+	copyContextCmdKey:        model.copyContext,
+	previewContextCmdKey:     model.openPreview,
+	togglePaneCmdKey:         model.togglePane,
+	focusPaneCmdKey:          model.focusPane,
+	searchCmdKey:             model.openSearch,
+	nextMatchCmdKey:          model.nextMatch,
+	prevMatchCmdKey:          model.prevMatch,
+	selectMatchesCmdKey:      model.selectMatches,
+	toggleSelectedModeCmdKey: model.toggleSelectedMode,
+	sortByNameCmdKey:         model.sortByName,
+	sortBySizeCmdKey:         model.sortBySize,
+	sortByTokensCmdKey:       model.sortByTokens,
+	sortByMtimeCmdKey:        model.sortByMtime,
+	selectDepsCmdKey:         model.selectDeps,
+	selectDependentsCmdKey:   model.selectDependents,
+	cycleOutlineCmdKey:       model.cycleOutline,
 }
 
 func filterKeymap(originalMap map[string]Keymap, prefix string) map[string]Keymap {
@@ -152,18 +303,7 @@ func filterKeymap(originalMap map[string]Keymap, prefix string) map[string]Keyma
 	return filteredMap
 }
 
-func initKeymaps() map[string]Keymap {
-	//TODO: add parameter for config
-	var keymaps = defaultKeymaps
-
-	fastLookupMap := make(map[string]Keymap)
-	for _, item := range keymaps {
-		fastLookupMap[item.keys] = item
-	}
-	return fastLookupMap
-}
-
-func initialModel(startPath string) model {
+func initialModel(startPath string) (model, error) {
 	path, err := filepath.Abs(startPath)
 	if err != nil {
 
@@ -171,17 +311,33 @@ func initialModel(startPath string) model {
 	}
 	root, _ := buildFileTree(path)
 
+	cfg := loadConfig(path, nil)
+	applyTheme(cfg)
+	keymaps, err := initKeymaps(cfg)
+	if err != nil {
+		return model{}, fmt.Errorf("invalid keymaps: %v", err)
+	}
+	budget, err := resolveBudget(cfg, readSettings(path))
+	if err != nil {
+		log.Printf("Invalid budget: %v", err)
+	}
+
 	loadState(root, path)
-	var keymaps = initKeymaps()
+	history := recordHistory(path, readHistory(path), selectionMap(collectSelection(root, path)))
 
 	return model{
 		root:            root,
-		visibleNodes:    flattenVisible(root),
+		visibleNodes:    flattenVisible(root, false),
 		cursor:          0,
 		keymaps:         keymaps,
 		keySeq:          "",
 		filteredKeymaps: keymaps,
-	}
+		history:         history,
+		historyPos:      len(history) - 1,
+		config:          cfg,
+		tokens:          NewTokenCounter(),
+		budget:          budget,
+	}, nil
 }
 
 func (m model) Init() tea.Cmd {
@@ -189,8 +345,21 @@ func (m model) Init() tea.Cmd {
 }
 
 func (m model) renderContent() string {
+	if m.previewMode {
+		return strings.ReplaceAll(m.previewText, "\t", "    ")
+	}
+	if m.profileMode {
+		return m.renderProfilePicker()
+	}
+
 	var s strings.Builder
 
+	if m.selectedMode && len(m.visibleNodes) == 0 {
+		return emptyDirStyle.Render("  Nothing selected") + "\n"
+	}
+	stats := m.treeStats()
+	running := 0
+
 	for i, node := range m.visibleNodes {
 
 		emptyDir := node.IsDir && len(node.Children) == 0
@@ -198,16 +367,34 @@ func (m model) renderContent() string {
 
 		icon := ""
 		if notEmptyDir {
-			if node.Expanded {
+			if node.Expanded || m.selectedMode {
 				icon = "▼"
 			} else {
 				icon = "▶"
 			}
+		} else if node.hasSymbols() && !m.selectedMode {
+			if node.Expanded {
+				icon = "▽"
+			} else {
+				icon = "▷"
+			}
 		}
 		addon := ""
 		if node.IsBinary {
 			addon = "(bin)"
 		}
+		if node.Ignored {
+			addon = "(ignored)"
+		}
+		if node.Selected && len(node.Ranges) > 0 {
+			addon = "[" + formatRanges(node.Ranges) + "]"
+		}
+		if node.Selected && node.Outline {
+			addon = "[outline]"
+		}
+		if node.Selected && len(node.Symbols) > 0 {
+			addon = "[" + strings.Join(node.Symbols, ",") + "]"
+		}
 		dirAddon := ""
 		if node.IsDir {
 			dirAddon = "/"
@@ -217,18 +404,42 @@ func (m model) renderContent() string {
 
 		line := fmt.Sprintf("%s %s %s%s %s", indent, icon, node.Name, dirAddon, addon)
 
+		// The selected only view shows the tokens of every file and the
+		// total up to it on the right, the tree the size and tokens.
+		right := annotation(node, stats[node])
+		if m.selectedMode {
+			total := ""
+			if !node.IsDir {
+				running += stats[node].Selected
+				total = formatTokenCount(running)
+			}
+			right = fmt.Sprintf("%7s %7s", formatTokenCount(stats[node].Selected), total)
+		}
+		// The styles keep a margin of 3 on the right.
+		if pad := m.viewport.Width - 3 - lipgloss.Width(line) - len(right); pad >= 2 {
+			line += strings.Repeat(" ", pad) + right
+		}
+
 		style := binFileStyle
 
-		if node.Selected {
+		selected := node.Selected
+		if node.Symbol != "" {
+			selected = node.symbolSelected()
+		}
+		if selected && (len(node.Ranges) > 0 || node.Outline || len(node.Symbols) > 0) {
+			style = partialFileStyle
+		} else if selected {
 			style = selectedFileStyle
 		} else if node.SomeSelected {
 			style = someSelectedStyle
+		} else if node.Ignored {
+			style = gitignoreFileStyle
 		} else if !node.IsBinary && !emptyDir {
 			style = textFileStyle
 		}
 
 		if m.cursor == i {
-			style = style.Width(m.viewport.Width).Background(lipgloss.Color("#444"))
+			style = style.Width(m.viewport.Width).Background(cursorColor)
 		}
 		line = style.Render(line)
 
@@ -237,6 +448,28 @@ func (m model) renderContent() string {
 	return s.String()
 }
 
+func (m model) renderProfilePicker() string {
+	var s strings.Builder
+	s.WriteString(descStyle.Render("Load profile (enter to load, esc to cancel)") + "\n\n")
+	if len(m.profileNames) == 0 {
+		s.WriteString(emptyDirStyle.Render("  No saved profiles, use 'punjado profile save <name>'") + "\n")
+	}
+	for i, name := range m.profileNames {
+		style := textFileStyle
+		if m.profileCursor == i {
+			style = style.Width(m.viewport.Width).Background(cursorColor)
+		}
+		s.WriteString(style.Render("  "+name) + "\n")
+	}
+	return s.String()
+}
+
+const toastDuration = 3 * time.Second
+
+type clearToastMsg struct {
+	id int
+}
+
 func keyMsgToKeyStr(msg string) string {
 	if len(msg) == 1 {
 		return msg
@@ -246,31 +479,48 @@ func keyMsgToKeyStr(msg string) string {
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	log.Printf("%+v", msg)
+	toastID := m.toastID
 
 	switch msg := msg.(type) {
 
+	case clearToastMsg:
+		if msg.id == m.toastID {
+			m.toast = ""
+		}
+
 	case tea.WindowSizeMsg:
 		m.height = msg.Height
 		m.width = msg.Width
 		headerHeight := 1
-		footerHeight := 1
-		if m.helpMode {
-			footerHeight = 10
-		}
-		verticalMargin := headerHeight + footerHeight
 
 		if !m.ready {
-			m.viewport = viewport.New(msg.Width, msg.Height-verticalMargin)
+			m.viewport = viewport.New(msg.Width, 0)
 			m.viewport.YPosition = headerHeight
 			m.ready = true
 		} else {
 			m.viewport.Width = msg.Width
-			m.viewport.Height = msg.Height - verticalMargin
 		}
+		m = m.resizeViewport()
 
 	case tea.KeyMsg:
 		keyStr := keyMsgToKeyStr(msg.String())
 		log.Printf("Pressed '%s'", keyStr)
+		if m.promptMode {
+			m = m.updatePrompt(msg)
+			break
+		}
+		if m.previewMode {
+			m = m.updatePreview(keyStr)
+			break
+		}
+		if m.profileMode {
+			m = m.updateProfilePicker(keyStr)
+			break
+		}
+		if m.paneFocused {
+			m = m.updatePane(keyStr)
+			break
+		}
 		m.keySeq = m.keySeq + keyStr
 		m.filteredKeymaps = filterKeymap(m.keymaps, m.keySeq)
 		log.Printf("keySeq '%s'", m.keySeq)
@@ -298,10 +548,23 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	if m.quitting {
 		return m, tea.Quit
 	}
+	if m.selectedMode {
+		// Files deselected in the selected only view, or brought back by an
+		// undo, come and go right away.
+		m = m.refreshVisible()
+	}
+	if m.paneOpen && m.currentFile() != m.pane.node {
+		m = m.loadPane()
+	}
 
 	m.viewport.SetContent(m.renderContent())
 
-	return m, nil
+	var cmd tea.Cmd
+	if m.toastID != toastID {
+		id := m.toastID
+		cmd = tea.Tick(toastDuration, func(time.Time) tea.Msg { return clearToastMsg{id: id} })
+	}
+	return m, cmd
 }
 
 func (m model) View() string {
@@ -313,7 +576,14 @@ func (m model) View() string {
 		footer = m.ViewExpandedHelp()
 	}
 
-	return fmt.Sprintf("%s%s%s", m.ViewHeader(), m.viewport.View(), footer)
+	body := m.viewport.View()
+	if m.paneOpen {
+		separator := emptyDirStyle.UnsetMarginRight().Render(strings.TrimSuffix(strings.Repeat("│\n", m.viewport.Height), "\n"))
+		paneWidth := max(m.width-m.viewport.Width-1, 0)
+		body = lipgloss.JoinHorizontal(lipgloss.Top, body, separator, m.renderPane(paneWidth))
+	}
+
+	return fmt.Sprintf("%s%s%s", m.ViewHeader(), body, footer)
 }
 
 func (m model) ViewHeader() string {
@@ -321,10 +591,16 @@ func (m model) ViewHeader() string {
 
 	count := m.countSelectedTokens()
 	tokenText := fmt.Sprintf("%d tokens", count)
+	if m.budget.Limit > 0 {
+		bar := renderBudgetBar(count, m.budget.Limit, 20)
+		tokenText = fmt.Sprintf("%s %d/%s tokens", bar, count, formatTokenCount(m.budget.Limit))
+	}
 
 	style := tokenStyle
-	if count > 32000 {
-		style = style.Background(lipgloss.Color("#E03A3E"))
+	if m.budget.Exceeded(count) {
+		style = style.Background(warningColor)
+	} else if m.budget.Limit > 0 && count*10 > m.budget.Limit*8 {
+		style = style.Background(lipgloss.Color("#B57614"))
 	}
 
 	w := m.width - lipgloss.Width(title) - lipgloss.Width(tokenText) - 4
@@ -351,28 +627,23 @@ func (m model) ViewExpandedHelp() string {
 		return colStyle.Render(strings.Join(lines, "\n"))
 	}
 
-	col1 := group("NAVIGATION",
-		"k/↑", "Up",
-		"j/↓", "Down",
-		"u", "Page Up",
-		"d", "Page Down",
-		"g", "Go to Top",
-		"G", "Go to Bottom",
-	)
-
-	col2 := group("SELECTION",
-		"space", "Toggle Dir",
-		"s", "Select File",
-		"enter", "Open Dir",
-		"a", "Toggle All",
-	)
-
-	col3 := group("ACTIONS",
-		"T", "Expand All",
-		"y", "Copy",
-		"q", "Quit",
-		"?", "Close Help",
-	)
+	var columns []string
+	for _, title := range helpGroups {
+		var keys []string
+		for _, doc := range commandDocs {
+			if doc.group != title {
+				continue
+			}
+			bound := keysForCommand(m.keymaps, doc.cmdKey)
+			if len(bound) == 0 {
+				continue
+			}
+			keys = append(keys, strings.Join(bound, "/"), doc.desc)
+		}
+		if len(keys) > 0 {
+			columns = append(columns, group(title, keys...))
+		}
+	}
 
 	prefix := "─── Help "
 	dashCount := m.width - len([]rune(prefix))
@@ -380,8 +651,7 @@ func (m model) ViewExpandedHelp() string {
 		dashCount = 0
 	}
 	headerLine := separatorStyle.Render(prefix + strings.Repeat("─", dashCount) + "\n")
-	columns := lipgloss.JoinHorizontal(lipgloss.Top, col1, col2, col3)
-	return "\n" + headerLine + "\n" + columns + "\n"
+	return "\n" + headerLine + "\n" + lipgloss.JoinHorizontal(lipgloss.Top, columns...) + "\n"
 }
 
 func (m model) ViewFooter() string {
@@ -389,13 +659,53 @@ func (m model) ViewFooter() string {
 		return keyStyle.Render(k) + descStyle.Render(desc)
 	}
 
-	// 1. Build the left side
-	leftSide := key("↑/↓", "move") +
-		key("space", "toggle dir") +
-		key("s", "select") +
-		key("q", "quit") +
-		key("a", "toggle all") +
-		key("y", "to clipboard")
+	if m.promptMode {
+		left := keyStyle.Render(m.promptLabel) + m.promptInput.View()
+		hint := ""
+		if m.promptHint != nil {
+			hint = descStyle.Render(m.promptHint(m, m.promptInput.Value()))
+		}
+		w := max(m.width-lipgloss.Width(left)-lipgloss.Width(hint), 0)
+		return "\n" + left + strings.Repeat(" ", w) + hint
+	}
+
+	if m.paneFocused {
+		left := key("j/k", "move") + key("v", "visual")
+		if m.pane.visual {
+			left += key("s", "select lines") + key("esc", "cancel")
+		} else {
+			left += key("tab", "tree") + key("p", "close")
+		}
+		toast := ""
+		if m.toast != "" {
+			toast = toastStyle.Render(m.toast)
+		}
+		w := max(m.width-lipgloss.Width(left)-lipgloss.Width(toast), 0)
+		return "\n" + left + strings.Repeat(" ", w) + toast
+	}
+
+	if m.previewMode {
+		left := key("y", "copy") + key("esc", "close") + key("j/k", "scroll")
+		info := descStyle.Render(fmt.Sprintf("%d files, %d tokens", m.previewFiles, m.previewTokens))
+		w := max(m.width-lipgloss.Width(left)-lipgloss.Width(info), 0)
+		return "\n" + left + strings.Repeat(" ", w) + info
+	}
+
+	// 1. Build the left side from the first key bound to the main commands
+	leftSide := ""
+	for _, item := range []struct{ cmdKey, desc string }{
+		{moveUpCmdKey, "up"},
+		{moveDownCmdKey, "down"},
+		{toggleFileCmdKey, "select"},
+		{toggleAllCmdKey, "toggle all"},
+		{copyContextCmdKey, "to clipboard"},
+		{toggleHelpCmdKey, "help"},
+		{quitCmdKey, "quit"},
+	} {
+		if bound := keysForCommand(m.keymaps, item.cmdKey); len(bound) > 0 {
+			leftSide += key(bound[0], item.desc)
+		}
+	}
 
 	// 2. Build the right side (the active sequence)
 	rightSide := ""
@@ -403,6 +713,13 @@ func (m model) ViewFooter() string {
 		// Give it a nice bold/colored style so the user notices it
 		seqStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#ffa000")).Bold(true)
 		rightSide = seqStyle.Render(m.keySeq)
+	} else if m.toast != "" {
+		rightSide = toastStyle.Render(m.toast)
+	} else if m.searchQuery != "" {
+		rightSide = descStyle.Render(fmt.Sprintf("/%s  %d/%d", m.searchQuery, m.matchPosition(), len(m.searchMatches)))
+	} else if m.selectedMode {
+		files := len(collectSelection(m.root, m.root.Path))
+		rightSide = descStyle.Render(fmt.Sprintf("selected only  %s, %d tokens", pluralFiles(files), m.countSelectedTokens()))
 	}
 
 	// 3. Calculate spacing
@@ -416,18 +733,21 @@ func (m model) ViewFooter() string {
 }
 
 func (m model) countSelectedTokens() int {
-	var totalSize int64
+	total := 0
 	var traverse func(n *FileNode)
 	traverse = func(n *FileNode) {
 		if !n.IsDir && n.Selected {
-			totalSize += n.Size
+			tokens, err := m.tokens.CountSelected(n.Path, n.state())
+			if err == nil {
+				total += tokens
+			}
 		}
 		for _, child := range n.Children {
 			traverse(child)
 		}
 	}
 	traverse(m.root)
-	return int(totalSize / 4)
+	return total
 }
 
 func RunTUI(startPath string) {
@@ -443,7 +763,13 @@ func RunTUI(startPath string) {
 	}
 
 	log.Printf("Starting Punjado TUI at '%s'!!", startPath)
-	p := tea.NewProgram(initialModel(startPath), tea.WithAltScreen())
+	m, err := initialModel(startPath)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	defer m.tokens.Save()
+	p := tea.NewProgram(m, tea.WithAltScreen())
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Error: %v", err)
 		os.Exit(1)
@@ -36,28 +36,38 @@ func isBinaryFile(path string) bool {
 	return false
 }
 
-func readConfig(dir string) map[string]bool {
-	m := make(map[string]bool)
+func readSelection(dir string) map[string]Selection {
 	// Construct the full path: dir/.punjado
 	path := filepath.Join(dir, ".punjado")
 
 	data, _ := os.ReadFile(path)
-	for _, line := range strings.Split(string(data), "\n") {
-		if s := strings.TrimSpace(line); s != "" {
-			m[s] = true
-		}
-	}
-	return m
+	return parseSelectionFile(data)
+}
+
+func readSettings(dir string) map[string]string {
+	data, _ := os.ReadFile(filepath.Join(dir, ".punjado"))
+	return parseSelectionSettings(data)
+}
+
+func writeSelection(dir string, m map[string]Selection) {
+	writeState(dir, readSettings(dir), m)
+}
+
+func writeSettings(dir string, settings map[string]string) {
+	writeState(dir, settings, readSelection(dir))
 }
 
-func writeConfig(dir string, m map[string]bool) {
-	var lines []string
-	for k := range m {
-		lines = append(lines, k)
+func writeState(dir string, settings map[string]string, m map[string]Selection) {
+	// An empty journal starts with the previous selection, so the first
+	// change made from the CLI can be reverted.
+	entries := readHistory(dir)
+	if len(entries) == 0 {
+		entries = recordHistory(dir, entries, readSelection(dir))
 	}
 
 	path := filepath.Join(dir, ".punjado")
-	os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644)
+	os.WriteFile(path, formatSelectionFile(settings, selectionList(m)), 0644)
+	recordHistory(dir, entries, m)
 }
 
 func VarifyFlags(userFlags map[string]string, allowedList []string) {
@@ -121,6 +131,131 @@ func ParseArgs() (string, []string, map[string]string, error) {
 			Short:        0,
 			HasParameter: false,
 		},
+		{
+			Long:         "sort",
+			Short:        0,
+			HasParameter: true,
+		},
+		{
+			Long:         "json",
+			Short:        0,
+			HasParameter: false,
+		},
+		{
+			Long:         "budget",
+			Short:        0,
+			HasParameter: true,
+		},
+		{
+			Long:         "profile",
+			Short:        0,
+			HasParameter: true,
+		},
+		{
+			Long:         "global",
+			Short:        0,
+			HasParameter: false,
+		},
+		{
+			Long:         "clipboard",
+			Short:        0,
+			HasParameter: true,
+		},
+		{
+			Long:         "glob",
+			Short:        0,
+			HasParameter: true,
+		},
+		{
+			Long:         "regex",
+			Short:        0,
+			HasParameter: true,
+		},
+		{
+			Long:         "exclude",
+			Short:        0,
+			HasParameter: true,
+		},
+		{
+			Long:         "format",
+			Short:        0,
+			HasParameter: true,
+		},
+		{
+			Long:         "template",
+			Short:        0,
+			HasParameter: true,
+		},
+		{
+			Long:         "priority",
+			Short:        0,
+			HasParameter: true,
+		},
+		{
+			Long:         "tree",
+			Short:        0,
+			HasParameter: false,
+		},
+		{
+			Long:         "tree-depth",
+			Short:        0,
+			HasParameter: true,
+		},
+		{
+			Long:         "staged",
+			Short:        0,
+			HasParameter: false,
+		},
+		{
+			Long:         "base",
+			Short:        0,
+			HasParameter: true,
+		},
+		{
+			Long:         "full",
+			Short:        0,
+			HasParameter: false,
+		},
+		{
+			Long:         "unstaged",
+			Short:        0,
+			HasParameter: false,
+		},
+		{
+			Long:         "untracked",
+			Short:        0,
+			HasParameter: false,
+		},
+		{
+			Long:         "outline",
+			Short:        0,
+			HasParameter: false,
+		},
+		{
+			Long:         "symbols",
+			Short:        0,
+			HasParameter: true,
+		},
+		{
+			Long:         "deps",
+			Short:        0,
+			HasParameter: false,
+		},
+		{
+			Long:         "depth",
+			Short:        0,
+			HasParameter: true,
+		},
+		{
+			Long:         "reverse",
+			Short:        0,
+			HasParameter: false,
+		},
+		{
+			Long:         "messages",
+			Short:        0,
+			HasParameter: false,
+		},
 	}
 
 	flagHasParameter := make(map[string]bool)
@@ -143,7 +278,7 @@ func ParseArgs() (string, []string, map[string]string, error) {
 
 	for i := 1; i < len(os.Args); i++ {
 		arg := os.Args[i]
-		if arg[0:2] == "--" {
+		if strings.HasPrefix(arg, "--") {
 			arg = arg[2:]
 			if val, ok := flagHasParameter[arg]; ok {
 				flagVal := ""
@@ -158,10 +293,10 @@ func ParseArgs() (string, []string, map[string]string, error) {
 			} else {
 				return "", nil, nil, fmt.Errorf("Flag '%s' is not recognised", arg)
 			}
-		} else if arg[0] == '-' {
+		} else if len(arg) > 1 && arg[0] == '-' {
 			arg = arg[1:]
-			for i := 0; i < len(arg); i++ {
-				c := arg[i]
+			for j := 0; j < len(arg); j++ {
+				c := arg[j]
 				if val, ok := shortFlagHasParameter[c]; ok {
 					flagVal := ""
 					if val {